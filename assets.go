@@ -0,0 +1,24 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"wormo/http"
+)
+
+//go:embed templates public
+var embeddedAssets embed.FS
+
+// loadAssets returns the assets compiled into the binary with their ETags,
+// which are worked out once as the assets can't change, or the contents of dir
+// when set so templates, scripts and styles can be edited without rebuilding.
+func loadAssets(dir string) (fs.FS, map[string]string, error) {
+	if dir != "" {
+		return os.DirFS(dir), nil, nil
+	}
+
+	etags, error := http.ETags(embeddedAssets)
+
+	return embeddedAssets, etags, error
+}
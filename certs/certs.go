@@ -0,0 +1,80 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+)
+
+const selfSignedValidFor = 365 * 24 * time.Hour
+
+func newConfig(certificate tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// Load reads a PEM encoded certificate and key pair from disk.
+func Load(certPath string, keyPath string) (*tls.Config, error) {
+	certificate, error := tls.LoadX509KeyPair(certPath, keyPath)
+
+	if error != nil {
+		return nil, error
+	}
+
+	return newConfig(certificate), nil
+}
+
+// NewSelfSigned generates an in-memory certificate for local development.
+// Browsers will warn about it, it should never be used in production.
+func NewSelfSigned(hosts []string) (*tls.Config, error) {
+	key, error := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if error != nil {
+		return nil, error
+	}
+
+	serialNumber, error := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if error != nil {
+		return nil, error
+	}
+
+	notBefore := time.Now()
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"wormo dev"}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(selfSignedValidFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, error := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if error != nil {
+		return nil, error
+	}
+
+	return newConfig(tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}), nil
+}
@@ -0,0 +1,143 @@
+package gamemap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Cell is what occupies a position on a map before any worms or food.
+type Cell byte
+
+const (
+	Open     Cell = '.'
+	Wall     Cell = '#'
+	Spawn    Cell = 'S'
+	FoodRich Cell = 'F'
+)
+
+const (
+	minSize = 10
+	maxSize = 255
+)
+
+// Map is the layout of a grid. Cells is indexed [x][y] like the game grid.
+type Map struct {
+	Width  int
+	Height int
+	Cells  [][]Cell
+}
+
+// New returns an open map of the given size.
+func New(width int, height int) *Map {
+	cells := make([][]Cell, width)
+
+	for x := range cells {
+		cells[x] = make([]Cell, height)
+
+		for y := range cells[x] {
+			cells[x][y] = Open
+		}
+	}
+
+	return &Map{width, height, cells}
+}
+
+// Parse reads a map drawn as text, one line per row of cells:
+//
+//	. open
+//	# wall
+//	S open, where worms prefer to spawn
+//	F open, where food is more likely to spawn
+//
+// Lines starting with ; are comments. Every row must be the same width.
+func Parse(reader io.Reader) (*Map, error) {
+	rows := []string{}
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if len(rows) > 0 && len(line) != len(rows[0]) {
+			return nil, fmt.Errorf("row %d is %d cells wide, expected %d", len(rows)+1, len(line), len(rows[0]))
+		}
+
+		rows = append(rows, line)
+	}
+
+	if error := scanner.Err(); error != nil {
+		return nil, error
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("map is empty")
+	}
+
+	width := len(rows[0])
+	height := len(rows)
+
+	if width < minSize || height < minSize || width > maxSize || height > maxSize {
+		return nil, fmt.Errorf("map is %dx%d, it must be between %d and %d cells on each side", width, height, minSize, maxSize)
+	}
+
+	gameMap := New(width, height)
+
+	for y, row := range rows {
+		for x := 0; x < width; x++ {
+			cell := Cell(row[x])
+
+			switch cell {
+			case Open, Wall, Spawn, FoodRich:
+				gameMap.Cells[x][y] = cell
+			default:
+				return nil, fmt.Errorf("unknown cell %q at %d:%d", row[x], x, y)
+			}
+		}
+	}
+
+	return gameMap, nil
+}
+
+// Load parses the map file at path.
+func Load(path string) (*Map, error) {
+	file, error := os.Open(path)
+
+	if error != nil {
+		return nil, error
+	}
+
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// IsWall reports whether x, y is a wall, positions off the map count as walls.
+func (gameMap *Map) IsWall(x int, y int) bool {
+	if x < 0 || x >= gameMap.Width || y < 0 || y >= gameMap.Height {
+		return true
+	}
+
+	return gameMap.Cells[x][y] == Wall
+}
+
+// Positions lists every x, y on the map holding cell.
+func (gameMap *Map) Positions(cell Cell) [][2]int {
+	positions := [][2]int{}
+
+	for x := 0; x < gameMap.Width; x++ {
+		for y := 0; y < gameMap.Height; y++ {
+			if gameMap.Cells[x][y] == cell {
+				positions = append(positions, [2]int{x, y})
+			}
+		}
+	}
+
+	return positions
+}
@@ -0,0 +1,120 @@
+package gamemap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func drawMap(width int, height int) string {
+	return strings.Repeat(strings.Repeat(".", width)+"\n", height)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		width   int
+		height  int
+		wantErr bool
+	}{
+		{"smallest", drawMap(minSize, minSize), minSize, minSize, false},
+		{"largest", drawMap(maxSize, maxSize), maxSize, maxSize, false},
+		{"too narrow", drawMap(minSize-1, minSize), 0, 0, true},
+		{"too short", drawMap(minSize, minSize-1), 0, 0, true},
+		{"too wide", drawMap(maxSize+1, minSize), 0, 0, true},
+		{"too tall", drawMap(minSize, maxSize+1), 0, 0, true},
+		{"comments and blank lines", "; arena\n\n" + drawMap(12, 10) + "; end\n", 12, 10, false},
+		{"trailing whitespace", strings.ReplaceAll(drawMap(10, 10), "\n", " \r\n"), 10, 10, false},
+		{"ragged rows", drawMap(10, 5) + drawMap(11, 5), 0, 0, true},
+		{"unknown cell", "x" + drawMap(10, 10)[1:], 0, 0, true},
+		{"empty", "; nothing\n", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gameMap, error := Parse(strings.NewReader(test.text))
+
+			if test.wantErr {
+				if error == nil {
+					t.Fatalf("expected an error, got a %dx%d map", gameMap.Width, gameMap.Height)
+				}
+
+				return
+			}
+
+			if error != nil {
+				t.Fatal(error)
+			}
+
+			if gameMap.Width != test.width || gameMap.Height != test.height {
+				t.Fatalf("got a %dx%d map, expected %dx%d", gameMap.Width, gameMap.Height, test.width, test.height)
+			}
+		})
+	}
+}
+
+func TestParseCells(t *testing.T) {
+	text := "#.........\n" +
+		".S........\n" +
+		"..F.......\n" +
+		drawMap(10, 7)
+
+	gameMap, error := Parse(strings.NewReader(text))
+
+	if error != nil {
+		t.Fatal(error)
+	}
+
+	cells := map[[2]int]Cell{
+		{0, 0}: Wall,
+		{1, 1}: Spawn,
+		{2, 2}: FoodRich,
+		{9, 9}: Open,
+	}
+
+	for position, cell := range cells {
+		if got := gameMap.Cells[position[0]][position[1]]; got != cell {
+			t.Errorf("cell %v is %q, expected %q", position, got, cell)
+		}
+	}
+
+	if !gameMap.IsWall(0, 0) || gameMap.IsWall(1, 0) {
+		t.Error("IsWall does not match the map")
+	}
+
+	if !gameMap.IsWall(-1, 0) || !gameMap.IsWall(10, 0) || !gameMap.IsWall(0, 10) {
+		t.Error("positions off the map should count as walls")
+	}
+
+	if spawns := gameMap.Positions(Spawn); len(spawns) != 1 || spawns[0] != [2]int{1, 1} {
+		t.Errorf("got spawn positions %v", spawns)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "small.txt")
+
+	if error := os.WriteFile(path, []byte(drawMap(minSize, minSize)), 0o644); error != nil {
+		t.Fatal(error)
+	}
+
+	gameMap, error := Load(path)
+
+	if error != nil {
+		t.Fatal(error)
+	}
+
+	if gameMap.Width != minSize || gameMap.Height != minSize {
+		t.Fatalf("got a %dx%d map", gameMap.Width, gameMap.Height)
+	}
+
+	if _, error := Load(filepath.Join(t.TempDir(), "missing.txt")); error == nil {
+		t.Fatal("expected an error loading a missing file")
+	}
+
+	if _, error := Load("../maps/arena.txt"); error != nil {
+		t.Fatalf("arena.txt: %v", error)
+	}
+}
@@ -0,0 +1,315 @@
+package gamemap
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Generators for Generate.
+const (
+	// GeneratorMaze carves two cell wide corridors with some loops.
+	GeneratorMaze = "maze"
+	// GeneratorCave grows open caverns from random noise.
+	GeneratorCave = "cave"
+)
+
+const (
+	caveFillChance      = 0.5
+	caveSmoothingRounds = 5
+	caveAttempts        = 20
+	mazeLoopChance      = 0.15
+	minOpenRatio        = 0.35
+	minSpawnCells       = 10
+)
+
+// SpawnClearance is how many open cells a spawning worm needs in front of its
+// head so it does not run straight into a wall.
+const SpawnClearance = 2
+
+// Generate builds a map with generator, the same seed always giving the same
+// map. Every open cell is reachable from every other, and enough of the map is
+// open for worms to spawn facing right with room to turn.
+func Generate(generator string, width int, height int, seed int64) (*Map, error) {
+	if width < minSize || height < minSize || width > maxSize || height > maxSize {
+		return nil, fmt.Errorf("map is %dx%d, it must be between %d and %d cells on each side", width, height, minSize, maxSize)
+	}
+
+	random := rand.New(rand.NewSource(seed))
+
+	switch generator {
+	case GeneratorMaze:
+		gameMap := generateMaze(random, width, height)
+
+		if !gameMap.playable() {
+			return nil, fmt.Errorf("%dx%d is too small for a maze", width, height)
+		}
+
+		return gameMap, nil
+	case GeneratorCave:
+		//caves are random enough that some come out too closed in, try again
+		for i := 0; i < caveAttempts; i++ {
+			gameMap := generateCave(random, width, height)
+
+			if gameMap.playable() {
+				return gameMap, nil
+			}
+		}
+
+		return nil, fmt.Errorf("could not generate a playable cave with seed %d", seed)
+	default:
+		return nil, fmt.Errorf("unknown map generator %q", generator)
+	}
+}
+
+func filled(width int, height int) *Map {
+	gameMap := New(width, height)
+
+	for x := range gameMap.Cells {
+		for y := range gameMap.Cells[x] {
+			gameMap.Cells[x][y] = Wall
+		}
+	}
+
+	return gameMap
+}
+
+// generateMaze carves a maze of 2x2 rooms separated by single walls with a
+// randomised depth first search, then knocks through some extra walls so
+// worms are not trapped in dead ends.
+func generateMaze(random *rand.Rand, width int, height int) *Map {
+	gameMap := filled(width, height)
+
+	roomsX := (width - 1) / 3
+	roomsY := (height - 1) / 3
+
+	carveRoom := func(i int, j int) {
+		for x := 1 + 3*i; x <= 2+3*i; x++ {
+			for y := 1 + 3*j; y <= 2+3*j; y++ {
+				gameMap.Cells[x][y] = Open
+			}
+		}
+	}
+
+	//opens the wall between room i, j and its neighbour di, dj away
+	carveDoor := func(i int, j int, di int, dj int) {
+		if di != 0 {
+			x := 3 + 3*i
+
+			if di < 0 {
+				x = 3 * i
+			}
+
+			gameMap.Cells[x][1+3*j] = Open
+			gameMap.Cells[x][2+3*j] = Open
+		} else {
+			y := 3 + 3*j
+
+			if dj < 0 {
+				y = 3 * j
+			}
+
+			gameMap.Cells[1+3*i][y] = Open
+			gameMap.Cells[2+3*i][y] = Open
+		}
+	}
+
+	directions := [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	visited := make([][]bool, roomsX)
+
+	for i := range visited {
+		visited[i] = make([]bool, roomsY)
+	}
+
+	stack := [][2]int{{random.Intn(roomsX), random.Intn(roomsY)}}
+	visited[stack[0][0]][stack[0][1]] = true
+	carveRoom(stack[0][0], stack[0][1])
+
+	for len(stack) > 0 {
+		room := stack[len(stack)-1]
+		neighbours := [][2]int{}
+
+		for _, direction := range directions {
+			i := room[0] + direction[0]
+			j := room[1] + direction[1]
+
+			if i >= 0 && i < roomsX && j >= 0 && j < roomsY && !visited[i][j] {
+				neighbours = append(neighbours, direction)
+			}
+		}
+
+		if len(neighbours) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		direction := neighbours[random.Intn(len(neighbours))]
+		next := [2]int{room[0] + direction[0], room[1] + direction[1]}
+
+		carveDoor(room[0], room[1], direction[0], direction[1])
+		carveRoom(next[0], next[1])
+
+		visited[next[0]][next[1]] = true
+		stack = append(stack, next)
+	}
+
+	for i := 0; i < roomsX; i++ {
+		for j := 0; j < roomsY; j++ {
+			if i+1 < roomsX && random.Float64() < mazeLoopChance {
+				carveDoor(i, j, 1, 0)
+			}
+
+			if j+1 < roomsY && random.Float64() < mazeLoopChance {
+				carveDoor(i, j, 0, 1)
+			}
+		}
+	}
+
+	gameMap.markSpawns()
+
+	return gameMap
+}
+
+// generateCave fills the map with random walls then smooths them into caverns,
+// keeping only the largest cavern so all open cells are connected.
+func generateCave(random *rand.Rand, width int, height int) *Map {
+	gameMap := filled(width, height)
+
+	for x := 1; x < width-1; x++ {
+		for y := 1; y < height-1; y++ {
+			if random.Float64() >= caveFillChance {
+				gameMap.Cells[x][y] = Open
+			}
+		}
+	}
+
+	for round := 0; round < caveSmoothingRounds; round++ {
+		next := filled(width, height)
+
+		for x := 1; x < width-1; x++ {
+			for y := 1; y < height-1; y++ {
+				walls := 0
+
+				for dx := -1; dx <= 1; dx++ {
+					for dy := -1; dy <= 1; dy++ {
+						if (dx != 0 || dy != 0) && gameMap.Cells[x+dx][y+dy] == Wall {
+							walls++
+						}
+					}
+				}
+
+				if walls < 5 {
+					next.Cells[x][y] = Open
+				}
+			}
+		}
+
+		gameMap = next
+	}
+
+	gameMap.keepLargestRegion()
+	gameMap.markSpawns()
+
+	return gameMap
+}
+
+// regions labels each open cell with the connected region it belongs to,
+// returning the labels and the size of each region.
+func (gameMap *Map) regions() ([][]int, []int) {
+	labels := make([][]int, gameMap.Width)
+
+	for x := range labels {
+		labels[x] = make([]int, gameMap.Height)
+
+		for y := range labels[x] {
+			labels[x][y] = -1
+		}
+	}
+
+	sizes := []int{}
+
+	for x := 0; x < gameMap.Width; x++ {
+		for y := 0; y < gameMap.Height; y++ {
+			if gameMap.IsWall(x, y) || labels[x][y] != -1 {
+				continue
+			}
+
+			region := len(sizes)
+			sizes = append(sizes, 0)
+
+			labels[x][y] = region
+			stack := [][2]int{{x, y}}
+
+			for len(stack) > 0 {
+				cell := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				sizes[region]++
+
+				for _, next := range [][2]int{{cell[0] + 1, cell[1]}, {cell[0] - 1, cell[1]}, {cell[0], cell[1] + 1}, {cell[0], cell[1] - 1}} {
+					if !gameMap.IsWall(next[0], next[1]) && labels[next[0]][next[1]] == -1 {
+						labels[next[0]][next[1]] = region
+						stack = append(stack, next)
+					}
+				}
+			}
+		}
+	}
+
+	return labels, sizes
+}
+
+func (gameMap *Map) keepLargestRegion() {
+	labels, sizes := gameMap.regions()
+
+	largest := -1
+
+	for region, size := range sizes {
+		if largest == -1 || size > sizes[largest] {
+			largest = region
+		}
+	}
+
+	for x := 0; x < gameMap.Width; x++ {
+		for y := 0; y < gameMap.Height; y++ {
+			if labels[x][y] != -1 && labels[x][y] != largest {
+				gameMap.Cells[x][y] = Wall
+			}
+		}
+	}
+}
+
+// markSpawns marks every cell a worm can spawn on facing right, with its body
+// behind it and SpawnClearance cells free in front of it.
+func (gameMap *Map) markSpawns() {
+	for x := 2; x < gameMap.Width; x++ {
+		for y := 0; y < gameMap.Height; y++ {
+			clear := true
+
+			for dx := -2; dx <= SpawnClearance; dx++ {
+				if gameMap.IsWall(x+dx, y) {
+					clear = false
+					break
+				}
+			}
+
+			if clear {
+				gameMap.Cells[x][y] = Spawn
+			}
+		}
+	}
+}
+
+// playable reports whether enough of the map is open, it is all connected and
+// there are enough places to spawn.
+func (gameMap *Map) playable() bool {
+	_, sizes := gameMap.regions()
+
+	if len(sizes) != 1 {
+		return false
+	}
+
+	if float64(sizes[0]) < minOpenRatio*float64(gameMap.Width*gameMap.Height) {
+		return false
+	}
+
+	return len(gameMap.Positions(Spawn)) >= minSpawnCells
+}
@@ -0,0 +1,125 @@
+package gamemap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator string
+		width     int
+		height    int
+	}{
+		{"smallest maze", GeneratorMaze, minSize, minSize},
+		{"wide maze", GeneratorMaze, 60, 20},
+		{"largest maze", GeneratorMaze, maxSize, maxSize},
+		{"smallest cave", GeneratorCave, minSize, minSize},
+		{"tall cave", GeneratorCave, 20, 60},
+		{"largest cave", GeneratorCave, maxSize, maxSize},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for seed := int64(0); seed < 5; seed++ {
+				gameMap, error := Generate(test.generator, test.width, test.height, seed)
+
+				if error != nil {
+					t.Fatalf("seed %d: %v", seed, error)
+				}
+
+				if gameMap.Width != test.width || gameMap.Height != test.height {
+					t.Fatalf("seed %d: got %dx%d, expected %dx%d", seed, gameMap.Width, gameMap.Height, test.width, test.height)
+				}
+
+				if !gameMap.playable() {
+					t.Fatalf("seed %d: map is not playable", seed)
+				}
+
+				for _, spawn := range gameMap.Positions(Spawn) {
+					for dx := -2; dx <= SpawnClearance; dx++ {
+						if gameMap.IsWall(spawn[0]+dx, spawn[1]) {
+							t.Fatalf("seed %d: spawn %v has no room", seed, spawn)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	for _, generator := range []string{GeneratorMaze, GeneratorCave} {
+		first, error := Generate(generator, 30, 30, 42)
+
+		if error != nil {
+			t.Fatalf("%s: %v", generator, error)
+		}
+
+		second, _ := Generate(generator, 30, 30, 42)
+
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("%s: the same seed gave different maps", generator)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator string
+		width     int
+		height    int
+	}{
+		{"unknown generator", "islands", 20, 20},
+		{"too narrow", GeneratorMaze, minSize - 1, 20},
+		{"too short", GeneratorCave, 20, minSize - 1},
+		{"too large", GeneratorMaze, maxSize + 1, 20},
+	}
+
+	for _, test := range tests {
+		if _, error := Generate(test.generator, test.width, test.height, 1); error == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestPlayable(t *testing.T) {
+	open := New(20, 20)
+	open.markSpawns()
+
+	if !open.playable() {
+		t.Error("an open map should be playable")
+	}
+
+	//a wall down the middle splits the map in two
+	split := New(20, 20)
+
+	for y := 0; y < split.Height; y++ {
+		split.Cells[10][y] = Wall
+	}
+
+	split.markSpawns()
+
+	if split.playable() {
+		t.Error("a split map should not be playable")
+	}
+
+	if walled := filled(20, 20); walled.playable() {
+		t.Error("a map of walls should not be playable")
+	}
+
+	//one open row is connected but mostly walls
+	corridor := filled(20, 20)
+
+	for x := 0; x < corridor.Width; x++ {
+		corridor.Cells[x][5] = Open
+	}
+
+	corridor.markSpawns()
+
+	if corridor.playable() {
+		t.Error("a single corridor should not be playable")
+	}
+}
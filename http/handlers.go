@@ -1,85 +1,313 @@
 package http
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
 	"log"
+	"mime"
 	"net/http"
-	"os"
+	"path"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func serveDirectory(dir string, w *http.ResponseWriter, r *http.Request, notFoundFile *[]byte) {
-	slashCount := 0
-	secondSlash := -1
+// precompressedEncodings lists the encodings that may be stored next to an
+// asset, eg. index.js.br, in order of preference.
+var precompressedEncodings = []struct {
+	name      string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// startTime stands in for the modification time of embedded files, which have
+// none, as they cannot change while the server is running.
+var startTime = time.Now()
+
+func writeNotFound(w http.ResponseWriter, notFoundFile []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(notFoundFile)
+}
+
+// sanitizePath turns the part of the url after prefix into a path inside dir,
+// returning false if it does not name a file within dir.
+func sanitizePath(dir string, prefix string, urlPath string) (string, bool) {
+	if !strings.HasPrefix(urlPath, prefix) {
+		return "", false
+	}
+
+	name := path.Clean("/" + urlPath[len(prefix):])
+
+	if name == "/" {
+		return "", false
+	}
+
+	filePath := path.Join(dir, name)
+
+	if !fs.ValidPath(filePath) {
+		return "", false
+	}
+
+	return filePath, true
+}
+
+// encodingQuality returns the q-value r's Accept-Encoding header gives
+// encoding, either by name or through *, and 0 if it is not acceptable.
+func encodingQuality(r *http.Request, encoding string) float64 {
+	quality := -1.0
+	wildcardQuality := -1.0
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(accepted, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(param, "=")
 
-	for i := 0; i < len(r.RequestURI); i++ {
-		if r.RequestURI[i] == '/' {
-			slashCount++
+			if !found || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+
+			parsed, error := strconv.ParseFloat(strings.TrimSpace(value), 64)
 
-			if slashCount == 2 {
-				secondSlash = i
-				break
+			//a malformed weight is treated as a refusal rather than guessed at
+			if error != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
 			}
+
+			q = parsed
 		}
+
+		switch name {
+		case encoding:
+			quality = q
+		case "*":
+			wildcardQuality = q
+		}
+	}
+
+	if quality >= 0 {
+		return quality
+	}
+
+	return max(wildcardQuality, 0)
+}
+
+func etag(content []byte) string {
+	hash := sha256.Sum256(content)
+
+	return "\"" + hex.EncodeToString(hash[:16]) + "\""
+}
+
+// ETags hashes every file in assets, for assets that can't change while the
+// server is running, eg. those embedded into the binary.
+func ETags(assets fs.FS) (map[string]string, error) {
+	etags := map[string]string{}
+
+	error := fs.WalkDir(assets, ".", func(filePath string, entry fs.DirEntry, error error) error {
+		if error != nil || entry.IsDir() {
+			return error
+		}
+
+		content, error := fs.ReadFile(assets, filePath)
+
+		if error != nil {
+			return error
+		}
+
+		etags[filePath] = etag(content)
+
+		return nil
+	})
+
+	return etags, error
+}
+
+func readFile(assets fs.FS, filePath string) ([]byte, time.Time, error) {
+	file, error := assets.Open(filePath)
+
+	if error != nil {
+		return nil, time.Time{}, error
+	}
+
+	defer file.Close()
+
+	info, error := file.Stat()
+
+	if error != nil {
+		return nil, time.Time{}, error
+	}
+
+	if info.IsDir() {
+		return nil, time.Time{}, fs.ErrNotExist
 	}
 
-	writer := (*w)
+	content, error := fs.ReadFile(assets, filePath)
+
+	modTime := info.ModTime()
+
+	if modTime.IsZero() {
+		modTime = startTime
+	}
 
-	if secondSlash == -1 {
-		log.Println("URL malformed for directory search")
+	return content, modTime, error
+}
 
-		writer.WriteHeader(500)
-		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
-		writer.Write(*notFoundFile)
+// serveDirectory serves the file under dir named by the part of the url after
+// prefix. Files missing from etags, eg. while editing assets, are hashed on
+// every request.
+func serveDirectory(assets fs.FS, etags map[string]string, dir string, prefix string, w http.ResponseWriter, r *http.Request, notFoundFile []byte) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 
 		return
 	}
 
-	filePath := dir + r.RequestURI[secondSlash:]
+	filePath, ok := sanitizePath(dir, prefix, r.URL.Path)
+
+	if !ok {
+		writeNotFound(w, notFoundFile)
+		return
+	}
 
-	file, error := os.ReadFile(filePath)
+	file, modTime, error := readFile(assets, filePath)
 
 	if error != nil {
-		log.Println("Error reading " + filePath)
+		if !errors.Is(error, fs.ErrNotExist) {
+			log.Println("Error reading "+filePath+": ", error)
+		}
 
-		writer.WriteHeader(500)
-		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
-		writer.Write(*notFoundFile)
+		writeNotFound(w, notFoundFile)
 
 		return
 	}
 
-	extension := filePath[strings.LastIndexByte(filePath, '.')+1:]
+	mimeType := mime.TypeByExtension(path.Ext(filePath))
 
-	var mimeType string
+	if mimeType == "" {
+		mimeType = http.DetectContentType(file)
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	servedPath := filePath
+	bestQuality := 0.0
+
+	//the encoding the client weights highest wins, the earlier one on a tie
+	for _, encoding := range precompressedEncodings {
+		quality := encodingQuality(r, encoding.name)
+
+		if quality <= bestQuality {
+			continue
+		}
 
-	switch extension {
-	case "js":
-		mimeType = "text/javascript"
-	case "css":
-		mimeType = "text/css"
-	case "png":
-		mimeType = "image/png"
-	default:
-		mimeType = "any"
+		compressed, compressedModTime, error := readFile(assets, filePath+encoding.extension)
+
+		if error == nil {
+			w.Header().Set("Content-Encoding", encoding.name)
+			servedPath = filePath + encoding.extension
+			file = compressed
+			modTime = compressedModTime
+			bestQuality = quality
+		}
+	}
+
+	fileETag, ok := etags[servedPath]
+
+	if !ok {
+		fileETag = etag(file)
 	}
 
-	writer.Header().Set("Content-Type", mimeType+"; charset=utf-8")
-	writer.Write(file)
+	w.Header().Set("ETag", fileETag)
+
+	http.ServeContent(w, r, filePath, modTime, bytes.NewReader(file))
 }
 
 func (server *Server) handleStyles(w http.ResponseWriter, r *http.Request) {
-	serveDirectory(server.stylesPath, &w, r, &server.notFoundFile)
+	serveDirectory(server.assets, server.etags, server.stylesPath, "/styles/", w, r, server.notFoundFile)
 }
 
 func (server *Server) handleScripts(w http.ResponseWriter, r *http.Request) {
-	serveDirectory(server.scriptsPath, &w, r, &server.notFoundFile)
+	serveDirectory(server.assets, server.etags, server.scriptsPath, "/scripts/", w, r, server.notFoundFile)
 }
 
 func (server *Server) handleImages(w http.ResponseWriter, r *http.Request) {
-	serveDirectory(server.imagesPath, &w, r, &server.notFoundFile)
+	serveDirectory(server.assets, server.etags, server.imagesPath, "/images/", w, r, server.notFoundFile)
 }
 
 func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Write(server.gameFile)
 }
+
+func (server *Server) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeNotFound(w, server.notFoundFile)
+}
+
+// statusWriter remembers whether a response has been started so a recovered
+// panic only writes the error page if nothing has been sent yet.
+type statusWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func newRequestId() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// recoverErrors wraps next so a panicking handler responds with the error page
+// and a 500, logging the request id sent back in the X-Request-Id header.
+func (server *Server) recoverErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := newRequestId()
+		w.Header().Set("X-Request-Id", requestId)
+
+		writer := &statusWriter{w, false}
+
+		defer func() {
+			recovered := recover()
+
+			if recovered == nil {
+				return
+			}
+
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			log.Printf("Request %s %s %s panicked: %v\n%s", requestId, r.Method, r.URL.Path, recovered, debug.Stack())
+
+			if !writer.wroteHeader {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(server.errorFile)
+			}
+		}()
+
+		next.ServeHTTP(writer, r)
+	})
+}
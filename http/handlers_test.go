@@ -0,0 +1,144 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSanitizePath(t *testing.T) {
+	tests := []struct {
+		urlPath string
+		want    string
+		ok      bool
+	}{
+		{"/scripts/index.js", "public/scripts/index.js", true},
+		{"/scripts/lib/util.js", "public/scripts/lib/util.js", true},
+		{"/scripts/../../main.go", "public/scripts/main.go", true},
+		{"/scripts/./index.js", "public/scripts/index.js", true},
+		{"/scripts//index.js", "public/scripts/index.js", true},
+		{"/scripts/", "", false},
+		{"/scripts/..", "", false},
+		{"/styles/index.css", "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := sanitizePath("public/scripts", "/scripts/", test.urlPath)
+
+		if got != test.want || ok != test.ok {
+			t.Errorf("sanitizePath(%q) = %q, %v, expected %q, %v", test.urlPath, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestEncodingQuality(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		want     float64
+	}{
+		{"", "br", 0},
+		{"gzip, deflate, br", "br", 1},
+		{"gzip, deflate, br", "gzip", 1},
+		{"br;q=0", "br", 0},
+		{"br; q=0", "br", 0},
+		{"br;q=0.0", "br", 0},
+		{"br;q=0.5, gzip", "br", 0.5},
+		{"BR;Q=0.8", "br", 0.8},
+		{"*", "br", 1},
+		{"*;q=0.3, gzip", "br", 0.3},
+		{"br;q=0, *", "br", 0},
+		{"br;q=abc", "br", 0},
+		{"br;q=2", "br", 0},
+		{"gzip", "br", 0},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", test.header)
+
+		if got := encodingQuality(r, test.encoding); got != test.want {
+			t.Errorf("encodingQuality(%q, %q) = %v, expected %v", test.header, test.encoding, got, test.want)
+		}
+	}
+}
+
+func TestServeDirectory(t *testing.T) {
+	assets := fstest.MapFS{
+		"public/scripts/index.js":    {Data: []byte("plain")},
+		"public/scripts/index.js.br": {Data: []byte("brotli")},
+		"public/scripts/index.js.gz": {Data: []byte("gzip")},
+		"public/scripts/other.js":    {Data: []byte("other")},
+	}
+
+	etags, error := ETags(assets)
+
+	if error != nil {
+		t.Fatal(error)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		status         int
+		body           string
+		encoding       string
+		etag           string
+		noETags        bool
+	}{
+		{"plain", "/scripts/index.js", "", http.StatusOK, "plain", "", etags["public/scripts/index.js"], false},
+		{"brotli preferred", "/scripts/index.js", "gzip, br", http.StatusOK, "brotli", "br", etags["public/scripts/index.js.br"], false},
+		{"brotli refused", "/scripts/index.js", "gzip, br;q=0", http.StatusOK, "gzip", "gzip", etags["public/scripts/index.js.gz"], false},
+		{"gzip weighted higher", "/scripts/index.js", "br;q=0.2, gzip;q=0.9", http.StatusOK, "gzip", "gzip", etags["public/scripts/index.js.gz"], false},
+		{"nothing precompressed", "/scripts/other.js", "br", http.StatusOK, "other", "", etags["public/scripts/other.js"], false},
+		{"hashed without etags", "/scripts/other.js", "", http.StatusOK, "other", "", etag([]byte("other")), true},
+		{"missing", "/scripts/missing.js", "", http.StatusNotFound, "not found", "", "", false},
+		{"directory", "/scripts/", "", http.StatusNotFound, "not found", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+
+			w := httptest.NewRecorder()
+
+			serveETags := etags
+
+			if test.noETags {
+				serveETags = nil
+			}
+
+			serveDirectory(assets, serveETags, "public/scripts", "/scripts/", w, r, []byte("not found"))
+
+			if w.Code != test.status || w.Body.String() != test.body {
+				t.Fatalf("got %d %q, expected %d %q", w.Code, w.Body.String(), test.status, test.body)
+			}
+
+			if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+				t.Errorf("got Content-Encoding %q, expected %q", got, test.encoding)
+			}
+
+			if got := w.Header().Get("ETag"); got != test.etag {
+				t.Errorf("got ETag %q, expected %q", got, test.etag)
+			}
+		})
+	}
+}
+
+func TestServeDirectoryNotModified(t *testing.T) {
+	assets := fstest.MapFS{"public/scripts/index.js": {Data: []byte("plain")}}
+	etags, _ := ETags(assets)
+
+	r := httptest.NewRequest(http.MethodGet, "/scripts/index.js", nil)
+	r.Header.Set("If-None-Match", etags["public/scripts/index.js"])
+
+	w := httptest.NewRecorder()
+	serveDirectory(assets, etags, "public/scripts", "/scripts/", w, r, nil)
+
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("got %d, expected %d", w.Code, http.StatusNotModified)
+	}
+}
@@ -1,13 +1,16 @@
 package http
 
 import (
+	"bytes"
 	"html/template"
+	"io/fs"
 	"net/http"
-	"os"
 	"strconv"
 )
 
 type Server struct {
+	assets       fs.FS
+	etags        map[string]string
 	gameFile     []byte
 	errorFile    []byte
 	notFoundFile []byte
@@ -17,7 +20,7 @@ type Server struct {
 	Server       *http.Server
 }
 
-func createGameFile(gridWidth uint8, gridHeight uint8, levelMultiplier uint8, gameFilePath string, wsPort uint16) error {
+func renderGameFile(assets fs.FS, gameTemplatePath string, gridWidth uint8, gridHeight uint8, levelMultiplier uint8, wsPort uint16) ([]byte, error) {
 	template, error := template.New("game.html").Funcs(template.FuncMap{
 		"iterate": func(count int) []int {
 			items := make([]int, count)
@@ -31,21 +34,15 @@ func createGameFile(gridWidth uint8, gridHeight uint8, levelMultiplier uint8, ga
 		"increment": func(i int) int {
 			return i + 1
 		},
-	}).ParseFiles("./templates/game.html")
+	}).ParseFS(assets, gameTemplatePath)
 
 	if error != nil {
-		return error
-	}
-
-	gameFile, error := os.Create(gameFilePath)
-
-	if error != nil {
-		return error
+		return nil, error
 	}
 
-	defer gameFile.Close()
+	var gameFile bytes.Buffer
 
-	error = template.Execute(gameFile, struct {
+	error = template.Execute(&gameFile, struct {
 		X               int
 		Y               int
 		TotalSize       int
@@ -60,44 +57,44 @@ func createGameFile(gridWidth uint8, gridHeight uint8, levelMultiplier uint8, ga
 	})
 
 	if error != nil {
-		return error
+		return nil, error
 	}
 
-	return nil
+	return gameFile.Bytes(), nil
 }
 
+// NewServer serves the game page and static files from assets, which is
+// either the embedded filesystem or an override directory during development.
+// All paths are relative to the root of assets. etags holds the ETags of
+// assets that can't change, see ETags, and may be nil.
 func NewServer(
 	port uint16,
 	wsPort uint16,
 	gridWidth uint8,
 	gridHeight uint8,
 	levelMultiplier uint8,
-	gameFilePath string,
+	assets fs.FS,
+	etags map[string]string,
+	gameTemplatePath string,
 	errorFilePath string,
 	notFoundFilePath string,
 	imagesPath string,
 	stylesPath string,
 	scriptsPath string,
 ) (*Server, error) {
-	error := createGameFile(gridWidth, gridHeight, levelMultiplier, gameFilePath, wsPort)
-
-	if error != nil {
-		return nil, error
-	}
-
-	gameFile, error := os.ReadFile(gameFilePath)
+	gameFile, error := renderGameFile(assets, gameTemplatePath, gridWidth, gridHeight, levelMultiplier, wsPort)
 
 	if error != nil {
 		return nil, error
 	}
 
-	errorFile, error := os.ReadFile(errorFilePath)
+	errorFile, error := fs.ReadFile(assets, errorFilePath)
 
 	if error != nil {
 		return nil, error
 	}
 
-	notFoundFile, error := os.ReadFile(notFoundFilePath)
+	notFoundFile, error := fs.ReadFile(assets, notFoundFilePath)
 
 	if error != nil {
 		return nil, error
@@ -108,6 +105,8 @@ func NewServer(
 	}
 
 	server := &Server{
+		assets,
+		etags,
 		gameFile,
 		errorFile,
 		notFoundFile,
@@ -118,12 +117,13 @@ func NewServer(
 	}
 
 	httpMux := http.NewServeMux()
-	httpMux.HandleFunc("/", server.handle)
+	httpMux.HandleFunc("/{$}", server.handle)
+	httpMux.HandleFunc("/", server.handleNotFound)
 	httpMux.HandleFunc("/scripts/", server.handleScripts)
 	httpMux.HandleFunc("/styles/", server.handleStyles)
 	httpMux.HandleFunc("/images/", server.handleImages)
 
-	httpServer.Handler = httpMux
+	httpServer.Handler = server.recoverErrors(httpMux)
 
 	return server, nil
 }
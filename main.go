@@ -1,9 +1,19 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	nethttp "net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"wormo/certs"
+	"wormo/gamemap"
 	"wormo/http"
 	"wormo/websocket"
 )
@@ -12,12 +22,232 @@ const ROWS uint8 = 40
 const COLS uint8 = 30
 const LEVEL_MULTIPLIER uint8 = 1
 
+func loadTLSConfig(certPath string, keyPath string, selfSigned bool, selfSignedHosts string) (*tls.Config, error) {
+	if certPath != "" || keyPath != "" {
+		return certs.Load(certPath, keyPath)
+	}
+
+	if selfSigned {
+		return certs.NewSelfSigned(strings.Split(selfSignedHosts, ","))
+	}
+
+	return nil, nil
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	return strings.Split(list, ",")
+}
+
+// parseFoodWeights parses a comma separated list of kind=weight pairs, eg.
+// common=20,golden=3,poison=2.
+func parseFoodWeights(list string) (map[string]int, error) {
+	weights := map[string]int{}
+
+	for _, pair := range splitList(list) {
+		kind, weightStr, found := strings.Cut(pair, "=")
+		kind = strings.ToUpper(strings.TrimSpace(kind))
+		weight, error := strconv.Atoi(strings.TrimSpace(weightStr))
+
+		if !found || error != nil || weight < 0 || !websocket.ValidFoodKind(kind) {
+			return nil, fmt.Errorf("invalid food weight %q, expected kind=weight with kind common, golden or poison", pair)
+		}
+
+		weights[kind] = weight
+	}
+
+	return weights, nil
+}
+
+// parseLevelCurve builds the named levelling curve, table taking a comma
+// separated list of the food needed at each length from 1.
+func parseLevelCurve(name string, table string) (websocket.LevelCurve, error) {
+	switch name {
+	case "linear":
+		return websocket.LinearCurve(int(LEVEL_MULTIPLIER)), nil
+	case "quadratic":
+		return websocket.QuadraticCurve(int(LEVEL_MULTIPLIER)), nil
+	case "table":
+		var foodNeeded []int
+
+		for _, entry := range splitList(table) {
+			food, error := strconv.Atoi(strings.TrimSpace(entry))
+
+			if error != nil || food < 1 {
+				return nil, fmt.Errorf("invalid level table entry %q, expected a positive number", entry)
+			}
+
+			foodNeeded = append(foodNeeded, food)
+		}
+
+		if len(foodNeeded) == 0 {
+			return nil, fmt.Errorf("-level-table must list the food needed at each length for the table curve")
+		}
+
+		return websocket.TableCurve(foodNeeded), nil
+	}
+
+	return nil, fmt.Errorf("invalid level curve %q, expected linear, quadratic or table", name)
+}
+
+// parseIdleAction checks action is one of the things done with idle players.
+func parseIdleAction(action string) (string, error) {
+	switch action {
+	case websocket.IdleActionKick, websocket.IdleActionBot, websocket.IdleActionSpectate:
+		return action, nil
+	}
+
+	return "", fmt.Errorf("invalid idle action %q, expected kick, bot or spectate", action)
+}
+
+// parseFriendlyFire checks rule is one of the rules for teammates running into
+// each other.
+func parseFriendlyFire(rule string) (string, error) {
+	switch rule {
+	case websocket.FriendlyFireBounce, websocket.FriendlyFirePass:
+		return rule, nil
+	}
+
+	return "", fmt.Errorf("invalid friendly fire rule %q, expected bounce or pass", rule)
+}
+
+func listen(server *nethttp.Server, tlsConfig *tls.Config) {
+	var error error
+
+	if tlsConfig != nil {
+		server.TLSConfig = tlsConfig
+		error = server.ListenAndServeTLS("", "")
+	} else {
+		error = server.ListenAndServe()
+	}
+
+	log.Println(error)
+}
+
 func main() {
 	httpPort := flag.Int("http-port", 8000, "port number for http connections")
 	wsPort := flag.Int("ws-port", 8001, "port number for ws connections")
+	tlsCert := flag.String("tls-cert", "", "path to a PEM certificate, serves https and wss when set with -tls-key")
+	tlsKey := flag.String("tls-key", "", "path to the PEM private key for -tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "serve https and wss with a generated self-signed certificate for development")
+	tlsHosts := flag.String("tls-hosts", "localhost,127.0.0.1,::1", "comma separated hosts for the self-signed certificate")
+	allowedOrigins := flag.String("allowed-origins", "", "comma separated origins allowed to open ws connections, eg. https://wormo.example, any when empty")
+	maxConnsPerIP := flag.Int("max-conns-per-ip", 0, "maximum simultaneous ws connections from one address, 0 for no limit")
+	maxPlayers := flag.Int("max-players", 0, "maximum number of worms in the game, 0 for no limit")
+	queueWhenFull := flag.Bool("queue-when-full", true, "queue connections for a free slot when the game is full instead of rejecting them")
+	maxMessageSize := flag.Int("max-message-size", 0, "maximum size in bytes of a client ws message, 0 for the default")
+	idleWarnAfter := flag.Duration("idle-warn-after", 0, "warn players who have not changed direction for this long, 0 for no warning")
+	idleActionAfter := flag.Duration("idle-action-after", 0, "act against players who have not changed direction for this long, 0 to disable")
+	idleAction := flag.String("idle-action", websocket.IdleActionKick, "what to do with idle players, kick, bot or spectate")
+	chatBlockedWords := flag.String("chat-blocked-words", "", "comma separated words to mask in chat messages")
+	adminToken := flag.String("admin-token", "", "bearer token for the ws server's /admin endpoints, disabled when empty")
+	teams := flag.Int("teams", 0, "number of teams worms are split into, 0 for no teams")
+	friendlyFire := flag.String("friendly-fire", websocket.FriendlyFireBounce, "what happens when teammates run into each other, bounce or pass")
+	roundDuration := flag.Duration("round-duration", 0, "length of each round, 0 for no time limit")
+	roundTargetLength := flag.Int("round-target-length", 0, "worm length that wins a round, 0 for no target. Rounds are played when this or -round-duration is set")
+	intermission := flag.Duration("intermission", 15*time.Second, "pause between rounds")
+	battleRoyale := flag.Bool("battle-royale", false, "eliminate worms reduced to length 1 and shrink the arena until one is left, rounds are played even without -round-duration or -round-target-length")
+	ringShrinkInterval := flag.Duration("ring-shrink-interval", 0, "how often the battle royale arena shrinks, 0 for the default")
+	wrapEdges := flag.Bool("wrap-edges", false, "worms leaving one side of the grid come back in on the opposite side")
+	mapPath := flag.String("map", "", "path to a map file laying out walls, spawn zones and food-rich regions, see maps/")
+	mapGenerator := flag.String("map-generator", "", "generate the map instead of loading one with -map, maze or cave. A new map is generated for every round")
+	mapSeed := flag.Int64("map-seed", 0, "seed for -map-generator, random when 0")
+	foodPerBomb := flag.Int("food-per-bomb", 0, "food a worm must eat to earn a bomb it can drop, 0 for no player bombs")
+	bombCooldown := flag.Duration("bomb-cooldown", 0, "how long a worm must wait between dropping bombs, 0 for the default")
+	slowdownFromLength := flag.Int("slowdown-from-length", 0, "worms longer than this move slower the longer they are, 0 for no slowdown")
+	boostCost := flag.Int("boost-cost", 0, "length a worm spends to double its speed for a while, 0 to disable boosting")
+	foodWeights := flag.String("food-weights", "", "comma separated kind=weight pairs for how often each kind of food spawns, eg. common=20,golden=3,poison=2. Only common food when empty")
+	foodExpiry := flag.Duration("food-expiry", 0, "remove food left uneaten for this long, 0 for food that lasts forever")
+	levelCurve := flag.String("level-curve", "linear", "how much food worms must eat to grow at each length, linear, quadratic or table")
+	levelTable := flag.String("level-table", "", "comma separated food needed at each length from 1 for the table -level-curve, eg. 1,2,3,5,8. Longer worms need the last entry")
+	itemInterval := flag.Duration("item-interval", 0, "how often power-up items may spawn, 0 for no items")
+	replayPath := flag.String("replay", "", "append every event broadcast to the game, and chat from muted players, as JSON lines to this file")
+	assetsDir := flag.String("assets-dir", "", "serve templates and public files from this directory instead of the embedded copies")
 
 	flag.Parse()
 
+	tlsConfig, error := loadTLSConfig(*tlsCert, *tlsKey, *tlsSelfSigned, *tlsHosts)
+
+	if error != nil {
+		log.Panic(error)
+	}
+
+	assets, etags, error := loadAssets(*assetsDir)
+
+	if error != nil {
+		log.Panic(error)
+	}
+
+	parsedFoodWeights, error := parseFoodWeights(*foodWeights)
+
+	if error != nil {
+		log.Panic(error)
+	}
+
+	parsedLevelCurve, error := parseLevelCurve(*levelCurve, *levelTable)
+
+	if error != nil {
+		log.Panic(error)
+	}
+
+	parsedIdleAction, error := parseIdleAction(*idleAction)
+
+	if error != nil {
+		log.Panic(error)
+	}
+
+	parsedFriendlyFire, error := parseFriendlyFire(*friendlyFire)
+
+	if error != nil {
+		log.Panic(error)
+	}
+
+	var replay io.Writer
+
+	if *replayPath != "" {
+		replay, error = os.OpenFile(*replayPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+
+		if error != nil {
+			log.Panic(error)
+		}
+	}
+
+	gridWidth := ROWS
+	gridHeight := COLS
+
+	var gameMap *gamemap.Map
+
+	//a loaded map would otherwise be replaced by a generated one from the second round
+	if *mapPath != "" && *mapGenerator != "" {
+		log.Panic("-map and -map-generator cannot be used together")
+	}
+
+	if *mapPath != "" {
+		gameMap, error = gamemap.Load(*mapPath)
+
+		if error != nil {
+			log.Panic(error)
+		}
+
+		gridWidth = uint8(gameMap.Width)
+		gridHeight = uint8(gameMap.Height)
+	} else if *mapGenerator != "" {
+		if *mapSeed == 0 {
+			*mapSeed = time.Now().UnixNano()
+		}
+
+		log.Println("Generating", *mapGenerator, "map with seed", *mapSeed)
+
+		gameMap, error = gamemap.Generate(*mapGenerator, int(gridWidth), int(gridHeight), *mapSeed)
+
+		if error != nil {
+			log.Panic(error)
+		}
+	}
+
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(2)
 
@@ -27,12 +257,14 @@ func main() {
 		server, error := http.NewServer(
 			uint16(*httpPort),
 			uint16(*wsPort),
-			ROWS,
-			COLS,
+			gridWidth,
+			gridHeight,
 			LEVEL_MULTIPLIER,
-			"./public/pages/game.html",
-			"./public/pages/error.html",
-			"./public/pages/pagenotfound.html",
+			assets,
+			etags,
+			"templates/game.html",
+			"public/pages/error.html",
+			"public/pages/pagenotfound.html",
 			"public/images",
 			"public/styles",
 			"public/scripts",
@@ -42,15 +274,46 @@ func main() {
 			log.Panic(error)
 		}
 
-		server.Server.ListenAndServe()
+		listen(server.Server, tlsConfig)
 	}()
 
 	go func() {
 		defer waitGroup.Done()
 
-		server := websocket.NewServer(uint16(*wsPort), ROWS, COLS, LEVEL_MULTIPLIER)
+		server := websocket.NewServer(uint16(*wsPort), gridWidth, gridHeight, LEVEL_MULTIPLIER, websocket.Config{
+			AllowedOrigins:     splitList(*allowedOrigins),
+			MaxConnsPerIP:      *maxConnsPerIP,
+			MaxPlayers:         *maxPlayers,
+			QueueWhenFull:      *queueWhenFull,
+			MaxMessageSize:     *maxMessageSize,
+			IdleWarnAfter:      *idleWarnAfter,
+			IdleActionAfter:    *idleActionAfter,
+			IdleAction:         parsedIdleAction,
+			ChatFilter:         websocket.NewWordFilter(splitList(*chatBlockedWords)),
+			AdminToken:         *adminToken,
+			Teams:              *teams,
+			FriendlyFire:       parsedFriendlyFire,
+			RoundDuration:      *roundDuration,
+			RoundTargetLength:  *roundTargetLength,
+			Intermission:       *intermission,
+			BattleRoyale:       *battleRoyale,
+			RingShrinkInterval: *ringShrinkInterval,
+			WrapEdges:          *wrapEdges,
+			Map:                gameMap,
+			MapGenerator:       *mapGenerator,
+			MapSeed:            *mapSeed,
+			ItemInterval:       *itemInterval,
+			FoodPerBomb:        *foodPerBomb,
+			BombCooldown:       *bombCooldown,
+			SlowdownFromLength: *slowdownFromLength,
+			BoostCost:          *boostCost,
+			FoodWeights:        parsedFoodWeights,
+			FoodExpiry:         *foodExpiry,
+			LevelCurve:         parsedLevelCurve,
+			Replay:             replay,
+		})
 
-		server.Server.ListenAndServe()
+		listen(server.Server, tlsConfig)
 	}()
 
 	waitGroup.Wait()
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"wormo/websocket"
+)
+
+func TestParseFoodWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		weights map[string]int
+		wantErr bool
+	}{
+		{"empty", "", map[string]int{}, false},
+		{"all kinds", "common=20,golden=3,poison=2", map[string]int{websocket.FoodCommon: 20, websocket.FoodGolden: 3, websocket.FoodPoison: 2}, false},
+		{"spaces and case", " Common = 5 , GOLDEN=1", map[string]int{websocket.FoodCommon: 5, websocket.FoodGolden: 1}, false},
+		{"zero weight", "poison=0", map[string]int{websocket.FoodPoison: 0}, false},
+		{"later wins", "golden=1,golden=4", map[string]int{websocket.FoodGolden: 4}, false},
+		{"unknown kind", "silver=3", nil, true},
+		{"missing weight", "golden", nil, true},
+		{"negative weight", "golden=-1", nil, true},
+		{"not a number", "golden=lots", nil, true},
+		{"empty entry", "common=1,", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			weights, error := parseFoodWeights(test.list)
+
+			if test.wantErr {
+				if error == nil {
+					t.Fatalf("expected an error, got %v", weights)
+				}
+
+				return
+			}
+
+			if error != nil {
+				t.Fatal(error)
+			}
+
+			if !reflect.DeepEqual(weights, test.weights) {
+				t.Fatalf("got %v, expected %v", weights, test.weights)
+			}
+		})
+	}
+}
+
+func TestParseLevelCurve(t *testing.T) {
+	tests := []struct {
+		name       string
+		curve      string
+		table      string
+		foodNeeded map[int]int
+		wantErr    bool
+	}{
+		{"linear", "linear", "", map[int]int{1: 1, 3: 3, 10: 10}, false},
+		{"quadratic", "quadratic", "", map[int]int{1: 1, 3: 9, 10: 100}, false},
+		{"table", "table", "2, 4,8", map[int]int{0: 2, 1: 2, 2: 4, 3: 8, 10: 8}, false},
+		{"table ignored by linear", "linear", "junk", map[int]int{4: 4}, false},
+		{"unknown curve", "cubic", "", nil, true},
+		{"empty table", "table", "", nil, true},
+		{"zero in table", "table", "1,0,3", nil, true},
+		{"word in table", "table", "1,two", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			curve, error := parseLevelCurve(test.curve, test.table)
+
+			if test.wantErr {
+				if error == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if error != nil {
+				t.Fatal(error)
+			}
+
+			for length, foodNeeded := range test.foodNeeded {
+				if got := curve(length); got != foodNeeded {
+					t.Errorf("length %d needs %d, expected %d", length, got, foodNeeded)
+				}
+			}
+		})
+	}
+}
+
+func TestParseIdleAction(t *testing.T) {
+	tests := []struct {
+		action  string
+		wantErr bool
+	}{
+		{websocket.IdleActionKick, false},
+		{websocket.IdleActionBot, false},
+		{websocket.IdleActionSpectate, false},
+		{"spectat", true},
+		{"Kick", true},
+		{"", true},
+	}
+
+	for _, test := range tests {
+		action, error := parseIdleAction(test.action)
+
+		if test.wantErr {
+			if error == nil {
+				t.Errorf("%q: expected an error", test.action)
+			}
+
+			continue
+		}
+
+		if error != nil || action != test.action {
+			t.Errorf("%q: got %q, %v", test.action, action, error)
+		}
+	}
+}
+
+func TestParseFriendlyFire(t *testing.T) {
+	tests := []struct {
+		rule    string
+		wantErr bool
+	}{
+		{websocket.FriendlyFireBounce, false},
+		{websocket.FriendlyFirePass, false},
+		{"Pass", true},
+		{"passthrough", true},
+		{"", true},
+	}
+
+	for _, test := range tests {
+		rule, error := parseFriendlyFire(test.rule)
+
+		if test.wantErr {
+			if error == nil {
+				t.Errorf("%q: expected an error", test.rule)
+			}
+
+			continue
+		}
+
+		if error != nil || rule != test.rule {
+			t.Errorf("%q: got %q, %v", test.rule, rule, error)
+		}
+	}
+}
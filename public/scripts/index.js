@@ -2,8 +2,21 @@ const grid = document.getElementById("wormo-grid");
 const foodCounter = document.getElementById("food-counter");
 const foodNeeded = document.getElementById("food-needed");
 const progressBar = document.getElementById("progress-inner");
+const levelCounter = document.getElementById("level");
 const loading = document.getElementById("ui-loading");
 const progressBox = document.getElementById("ui-progress");
+const idleBox = document.getElementById("ui-idle");
+const spectatorCounter = document.getElementById("spectator-counter");
+const chatMessages = document.getElementById("chat-messages");
+const chatInput = document.getElementById("chat-input");
+const scoresBox = document.getElementById("ui-scores");
+const roundBox = document.getElementById("ui-round");
+const roundEndBox = document.getElementById("ui-round-end");
+const noticeBox = document.getElementById("ui-notice");
+const effectsBox = document.getElementById("effects");
+const bombsBox = document.getElementById("bombs-held");
+
+const wantsToSpectate = new URL(document.URL).searchParams.has("spectate");
 
 let bombImageSrc;
 
@@ -27,6 +40,11 @@ const TOTAL_SPACES = GRID_ROWS * GRID_ROWS;
 
 const generateRandomColour = () => '#' + (Math.random().toString(16) + "000000").substring(2,8);
 
+const TEAM_COLOURS = ["#e6194b", "#4363d8", "#3cb44b", "#f58231", "#911eb4", "#42d4f4"];
+
+//worms in a team share a body colour, 0 means no team
+const wormColour = (team) => team > 0 ? TEAM_COLOURS[(team - 1) % TEAM_COLOURS.length] : generateRandomColour();
+
 const addColourToCell = ({x, y}, colour) => {
     const index = x + y * GRID_COLS;
     console.debug(`Adding colour ${colour} to ${x},${y}`)
@@ -59,16 +77,30 @@ const removeBorderColourFromCell = ({x, y}) => {
     cell.style.removeProperty("border-color");
 };
 
-const addFoodToCell = ({x, y}, colour) => {
+//common food is given a random colour
+const FOOD_COLOURS = {
+    GOLDEN: "gold",
+    POISON: "purple",
+};
+
+const addFoodToCell = ({x, y}, kind) => {
     const index = x + y * GRID_COLS;
-    console.debug(`Adding worm food to ${x},${y}`)
+    console.debug(`Adding ${kind} worm food to ${x},${y}`)
 
     const cell = grid.children.item(index);
-    cell.innerHTML = "&#x25CF;";
+    cell.innerHTML = kind === "POISON" ? "&#x2620;" : "&#x25CF;";
     cell.classList.add("worm-food");
-    cell.style.color = colour;
+    cell.dataset.food = kind;
+    cell.style.color = FOOD_COLOURS[kind] ?? generateRandomColour();
 };
 
+//food is sent as a line for each kind, eg. GOLDEN,1:1,2:2
+const parseFood = (str) => str.split("\n").map((line) => {
+    const firstComma = line.indexOf(',');
+
+    return [line.slice(0, firstComma), parsePositions(line.slice(firstComma + 1))];
+});
+
 const removeFoodFromCell = ({x, y}) => {
     const index = x + y * GRID_COLS;
     console.debug(`Removing worm food from ${x},${y}`)
@@ -76,9 +108,106 @@ const removeFoodFromCell = ({x, y}) => {
     const cell = grid.children.item(index);
     cell.innerHTML = "";
     cell.classList.remove("worm-food");
-    cell.style.removeProperty("colour");
+    cell.style.removeProperty("color");
+    delete cell.dataset.food;
+};
+
+const clearFood = () => {
+    for(const cell of grid.querySelectorAll(".worm-food")){
+        cell.innerHTML = "";
+        cell.classList.remove("worm-food");
+        cell.style.removeProperty("color");
+        delete cell.dataset.food;
+    }
+};
+
+const ITEM_SYMBOLS = {
+    SPEED: "&#x26A1;",
+    SHIELD: "&#x1F6E1;",
+    GHOST: "&#x1F47B;",
+    MAGNET: "&#x1F9F2;",
+};
+
+const addItemToCell = ({x, y}, kind) => {
+    const index = x + y * GRID_COLS;
+    console.debug(`Adding ${kind} item to ${x},${y}`)
+
+    const cell = grid.children.item(index);
+    cell.innerHTML = ITEM_SYMBOLS[kind];
+    cell.classList.add("worm-item");
+};
+
+const removeItemFromCell = ({x, y}) => {
+    const index = x + y * GRID_COLS;
+    console.debug(`Removing item from ${x},${y}`)
+
+    const cell = grid.children.item(index);
+    cell.innerHTML = "";
+    cell.classList.remove("worm-item");
+};
+
+const clearItems = () => {
+    for(const cell of grid.querySelectorAll(".worm-item")){
+        cell.innerHTML = "";
+        cell.classList.remove("worm-item");
+    }
+
+    items = new Map();
+};
+
+const parseItems = (str) => str.split("\n").map((unparsedItem) => {
+    const [id, kind, unparsedPosition] = unparsedItem.split(',');
+
+    return [id, kind, parsePosition(unparsedPosition)];
+});
+
+//effects from items the player's worm has picked up
+const updateEffects = () => {
+    const effects = worms.has(playerId) ? [...worms.get(playerId).effects] : [];
+    effectsBox.textContent = effects.length > 0 ? "Effects: " + effects.join(", ").toLowerCase() : "";
+};
+
+//the kind of bomb each key drops
+const BOMB_KEYS = {
+    " ": "SQUARE",
+    "l": "LINE",
+    "c": "CLUSTER",
+    "m": "MINE",
+};
+
+let bombCooldownTimeoutId = null;
+
+//bombs the player has earned to drop, and the milliseconds until they can drop the next
+const updateBombs = (held, cooldownMilliseconds) => {
+    clearTimeout(bombCooldownTimeoutId);
+
+    bombsBox.textContent = held > 0 ? "Bombs: " + held + (cooldownMilliseconds > 0 ? " (cooling down)" : " - press space, l, c or m to drop") : "";
+
+    if(held > 0 && cooldownMilliseconds > 0){
+        bombCooldownTimeoutId = setTimeout(() => updateBombs(held, 0), cooldownMilliseconds);
+    }
 };
 
+const addChatNotice = (text) => {
+    const chatMessage = document.createElement("div");
+    chatMessage.className = "chat-notice";
+    chatMessage.textContent = text;
+
+    chatMessages.appendChild(chatMessage);
+    chatMessages.scrollTop = chatMessages.scrollHeight;
+};
+
+const drawWalls = (wallsMsg) => {
+    for(const cell of grid.querySelectorAll(".wall")){
+        cell.classList.remove("wall");
+    }
+
+    if(wallsMsg){
+        for(const {x, y} of parsePositions(wallsMsg)){
+            grid.children.item(x + y * GRID_COLS).classList.add("wall");
+        }
+    }
+};
 
 const updateFoodCounter = (consumed, needed) => {
     foodCounter.innerHTML = consumed;
@@ -88,6 +217,10 @@ const updateFoodCounter = (consumed, needed) => {
     progressBar.style.width = percentage + '%';
 };
 
+const updateLevel = (level) => {
+    levelCounter.textContent = level;
+};
+
 const parsePosition = (str) => {
     const [x, y] = str.split(':');
     return {x: parseInt(x), y: parseInt(y)};
@@ -113,9 +246,9 @@ const parseNewEvent = (str) => {
 };
 
 const parseSpawnBombEvent = (str) => {
-    const [id, timeToDetonateSeconds, unparsedBombPosition, unparsedPositions] = str.split('|');
+    const [id, timeToDetonateSeconds, unparsedBombPosition, unparsedPositions, owner, type] = str.split('|');
 
-    return [id, parseInt(timeToDetonateSeconds), parsePosition(unparsedBombPosition), parsePositions(unparsedPositions)];
+    return [id, parseInt(timeToDetonateSeconds), parsePosition(unparsedBombPosition), parsePositions(unparsedPositions), owner, type];
 };
 
 class Worm {
@@ -128,6 +261,8 @@ class Worm {
         this.positions = positions;
         this.colour = colour;
         this.headColour = headColour;
+        this.classes = new Set();
+        this.effects = new Set();
 
         for(let i = 1; i < positions.length; i++){
             addColourToCell(positions[i], colour);
@@ -149,13 +284,67 @@ class Worm {
         addColourToCell(positions[0], this.headColour);
 
         this.positions = positions;
+        this.markClasses(true);
     }
 
     clearPositions() {
+        this.markClasses(false);
+
         for(const position of this.positions){
             removeColourFromCell(position);
         }
     }
+
+    /**
+        @milliseconds number How long the worm is protected after spawning
+    **/
+    setInvulnerable(milliseconds) {
+        clearTimeout(this.invulnerableTimeoutId);
+
+        this.setClass("invulnerable", true);
+
+        this.invulnerableTimeoutId = setTimeout(() => this.setClass("invulnerable", false), milliseconds);
+    }
+
+    /**
+        @kind string The kind of item the effect came from, eg. SPEED
+        @active boolean
+    **/
+    setEffect(kind, active) {
+        if(active){
+            this.effects.add(kind);
+        } else{
+            this.effects.delete(kind);
+        }
+
+        this.setClass("effect-" + kind.toLowerCase(), active);
+    }
+
+    clearEffects() {
+        for(const kind of this.effects){
+            this.setEffect(kind, false);
+        }
+    }
+
+    setClass(className, active) {
+        this.markClasses(false);
+
+        if(active){
+            this.classes.add(className);
+        } else{
+            this.classes.delete(className);
+        }
+
+        this.markClasses(true);
+    }
+
+    markClasses(active) {
+        for(const {x, y} of this.positions){
+            for(const className of this.classes){
+                grid.children.item(x + y * GRID_COLS).classList.toggle(className, active);
+            }
+        }
+    }
 }
 
 class Bomb {
@@ -163,25 +352,42 @@ class Bomb {
         @param {{x: number, y: number}} bombPosition The position of the bomb
         @param {{x: number, y: number}[]} positions The surrounding positions in the bomb's range
         @param {number} timeToDetonateSeconds How long for bomb to detonate
+        @param {string} type The kind of bomb, eg. SQUARE, LINE, CLUSTER or MINE
     **/
-    constructor(bombPosition, positions, timeToDetonateSeconds) {
+    constructor(bombPosition, positions, timeToDetonateSeconds, type) {
         this.bombPosition = bombPosition;
         this.positions = positions;
         this.timeToDetonateSeconds = timeToDetonateSeconds;
 
-        const bombOverlay = document.createElement("div");
-        bombOverlay.className = "bomb-overlay";
-        bombOverlay.style.gridColumn = (positions[0].x + 1) + '/' + (positions[positions.length - 1].x + 2);
-        bombOverlay.style.gridRow = (positions[0].y + 1) + '/' + (positions[positions.length - 1].y + 2);
+        const first = positions[0];
+        const last = positions[positions.length - 1];
+
+        //blasts that wrap around the edges of the grid are not one rectangle
+        const isRectangle = last.x >= first.x && last.y >= first.y
+            && positions.length === (last.x - first.x + 1) * (last.y - first.y + 1);
+
+        const overlayAreas = isRectangle ? [[first, last]] : positions.map((position) => [position, position]);
 
         const bombTimer = document.createElement("span");
         bombTimer.className = "bomb-timer";
         bombTimer.innerHTML = timeToDetonateSeconds;
 
-        bombOverlay.appendChild(bombTimer);
+        this.bombTimer = bombTimer;
+        this.bombOverlays = [];
 
-        grid.appendChild(bombOverlay);
-        this.bombOverlay = bombOverlay;
+        for(const [from, to] of overlayAreas){
+            const bombOverlay = document.createElement("div");
+            bombOverlay.className = "bomb-overlay bomb-" + type.toLowerCase();
+            bombOverlay.style.gridColumn = (from.x + 1) + '/' + (to.x + 2);
+            bombOverlay.style.gridRow = (from.y + 1) + '/' + (to.y + 2);
+
+            if(isRectangle || (from.x === bombPosition.x && from.y === bombPosition.y)){
+                bombOverlay.appendChild(bombTimer);
+            }
+
+            grid.appendChild(bombOverlay);
+            this.bombOverlays.push(bombOverlay);
+        }
 
         const bombImage = document.createElement("img");
         bombImage.className = "bomb-image";
@@ -197,7 +403,7 @@ class Bomb {
 
     decrement() {
         this.timeToDetonateSeconds--;
-        this.bombOverlay.children[0].innerHTML = this.timeToDetonateSeconds;
+        this.bombTimer.innerHTML = this.timeToDetonateSeconds;
 
         if(this.timeToDetonateSeconds <= 0){
             clearInterval(this.intervalId);
@@ -205,15 +411,49 @@ class Bomb {
     }
 
     detonate() {
-        this.bombOverlay.remove();
+        for(const bombOverlay of this.bombOverlays){
+            bombOverlay.remove();
+        }
+
         this.bombImage.remove();
     }
 }
 
+const clearBombs = () => {
+    for(const [_, bomb] of bombs){
+        clearInterval(bomb.intervalId);
+        bomb.detonate();
+    }
+
+    bombs = new Map();
+};
+
 let worms = new Map();
 let bombs = new Map();
+let items = new Map();
 let ws;
 let isInitialised = false;
+let currentRound = null;
+let roundIntervalId = null;
+
+/**
+    @param {number} seconds Seconds left to count down from, displayed as m:ss
+    @param {(text: string) => void} display Called with the time left every second
+**/
+const startCountdown = (seconds, display) => {
+    clearInterval(roundIntervalId);
+
+    const format = () => Math.floor(seconds / 60) + ':' + String(seconds % 60).padStart(2, '0');
+    display(format());
+
+    roundIntervalId = setInterval(() => {
+        if(seconds > 0){
+            seconds--;
+        }
+
+        display(format());
+    }, 1000);
+};
 
 const wsEvents = {
     MOVE: "MOVE",
@@ -226,8 +466,34 @@ const wsEvents = {
     NEW: "NEW",
     DISCONNECT: "DISCONNECT",
     COLLIDE: "COLLIDE",
+    FULL: "FULL",
+    ERROR: "ERROR",
+    PING: "PING",
+    PONG: "PONG",
+    IDLE: "IDLE",
+    SPECTATORS: "SPECTATORS",
+    CHAT: "CHAT",
+    SCORES: "SCORES",
+    ROUNDSTART: "ROUNDSTART",
+    ROUNDEND: "ROUNDEND",
+    ELIMINATED: "ELIMINATED",
+    RING: "RING",
+    MAP: "MAP",
+    INVULNERABLE: "INVULNERABLE",
+    SPAWNITEM: "SPAWNITEM",
+    CONSUMEITEM: "CONSUMEITEM",
+    EFFECTEND: "EFFECTEND",
+    DROPBOMB: "DROPBOMB",
+    BOMBS: "BOMBS",
+    KILL: "KILL",
+    BOOST: "BOOST",
+    FOODDECAY: "FOODDECAY",
+    LEVELUP: "LEVELUP",
 };
 
+//events handled before the player has been sent INIT, eg. while queued
+const preInitEvents = [wsEvents.INIT, wsEvents.FULL, wsEvents.ERROR, wsEvents.PING];
+
 const handleWsMsg = ({ data }) => {
     console.debug("ws msg: " + data);
 
@@ -236,11 +502,43 @@ const handleWsMsg = ({ data }) => {
     const event = data.slice(0, firstNewLine);
     const msg = data.slice(firstNewLine + 1, data.length);
 
-    if(event != wsEvents.INIT && !isInitialised){
+    if(!preInitEvents.includes(event) && !isInitialised){
         return;
     }
 
     switch(event){
+        case wsEvents.PING: {
+            ws.send(wsEvents.PONG);
+
+            break;
+        }
+        case wsEvents.IDLE: {
+            const secondsRemaining = parseInt(msg);
+
+            if(secondsRemaining > 0){
+                idleBox.innerHTML = "Still there? Press an arrow key within " + secondsRemaining + " seconds";
+            } else{
+                idleBox.innerHTML = "You were idle, press an arrow key to take back control";
+            }
+
+            idleBox.style.visibility = "visible";
+
+            break;
+        }
+        case wsEvents.ERROR: {
+            console.warn("Server rejected message: " + msg);
+
+            break;
+        }
+        case wsEvents.FULL: {
+            if(firstNewLine === -1){
+                loading.innerHTML = "Game is full";
+            } else{
+                loading.innerHTML = "Game is full, position in queue: " + msg;
+            }
+
+            break;
+        }
         case wsEvents.CONSUMEFOOD: {
             const [idPosMsg, consumedNeededMsg] = msg.split('|');
             const [id, unparsedPosition] = idPosMsg.split(',');
@@ -259,8 +557,8 @@ const handleWsMsg = ({ data }) => {
             for(const unparsedWorm of msg.split("\n")){
                 const [id, positions] = parseNewEvent(unparsedWorm);
 
-                if(id === playerId && positions.length !== worms.get(playerId).positions.length){
-                    updateFoodCounter(0, positions.length * LEVEL_MULTIPLIER)
+                if(id === playerId){
+                    updateLevel(positions.length);
                 }
 
                 worms.get(id).updatePositions(positions);
@@ -269,27 +567,53 @@ const handleWsMsg = ({ data }) => {
             break;
         }
         case wsEvents.SPAWNFOOD: {
-            const foodPositions = parsePositions(msg);
+            for(const [kind, foodPositions] of parseFood(msg)){
+                for(const foodPosition of foodPositions){
+                    addFoodToCell(foodPosition, kind);
+                }
+            }
+
+            break;
+        }
+        case wsEvents.LEVELUP: {
+            const [id, level, needed] = msg.split('|');
 
-            for(const foodPosition of foodPositions){
-                addFoodToCell(foodPosition, generateRandomColour());
+            if(id === playerId){
+                updateLevel(level);
+                updateFoodCounter(0, needed);
+            }
+
+            break;
+        }
+        case wsEvents.COLLIDE: {
+            const [consumed, needed] = msg.split('/');
+            updateFoodCounter(consumed, needed);
+
+            break;
+        }
+        case wsEvents.FOODDECAY: {
+            for(const foodPosition of parsePositions(msg)){
+                removeFoodFromCell(foodPosition);
             }
 
             break;
         }
         case wsEvents.SPAWNBOMB: {
-            const [id, timeToDetonateSeconds, bombPosition, positions] = parseSpawnBombEvent(msg);
+            const [id, timeToDetonateSeconds, bombPosition, positions, _, type] = parseSpawnBombEvent(msg);
 
-            const bomb = new Bomb(bombPosition, positions, timeToDetonateSeconds);
+            const bomb = new Bomb(bombPosition, positions, timeToDetonateSeconds, type);
             bombs.set(id, bomb);
 
             break;
         }
         case wsEvents.DETONATEBOMB: {
-            const [bombId, unparsedWorms] = msg.split('|');
+            const [bombId, _, unparsedWorms] = msg.split('|');
 
-            bombs.get(bombId).detonate();
-            bombs.delete(bombId);
+            //mines laid by others were never shown
+            if(bombs.has(bombId)){
+                bombs.get(bombId).detonate();
+                bombs.delete(bombId);
+            }
 
             if(unparsedWorms !== undefined){
                 for(const unparsedWorm of unparsedWorms.split("\n")){
@@ -305,14 +629,236 @@ const handleWsMsg = ({ data }) => {
             worms.get(msg).clearPositions();
             worms.delete(msg);
 
+            if(msg === playerId){
+                playerId = null;
+                progressBox.style.visibility = "hidden";
+            }
+
+            break;
+        }
+        case wsEvents.CHAT: {
+            const firstBar = msg.indexOf('|');
+            const secondBar = msg.indexOf('|', firstBar + 1);
+
+            const chatMessage = document.createElement("div");
+            chatMessage.textContent = msg.slice(firstBar + 1, secondBar) + ": " + msg.slice(secondBar + 1);
+
+            chatMessages.appendChild(chatMessage);
+            chatMessages.scrollTop = chatMessages.scrollHeight;
+
+            break;
+        }
+        case wsEvents.SCORES: {
+            scoresBox.innerHTML = "";
+
+            for(const unparsedScore of msg.split("\n")){
+                const [team, score] = unparsedScore.split(',');
+
+                const teamScore = document.createElement("div");
+                teamScore.textContent = "Team " + team + ": " + score;
+                teamScore.style.color = wormColour(parseInt(team));
+
+                scoresBox.appendChild(teamScore);
+            }
+
+            scoresBox.style.visibility = "visible";
+
+            break;
+        }
+        case wsEvents.ROUNDSTART: {
+            const [round, secondsRemaining, targetLength, spawnFoodNeeded] = msg.split('|').map((n) => parseInt(n));
+
+            //the board is reset between rounds, players joining mid round were sent it in INIT
+            if(currentRound !== null && currentRound !== round){
+                clearFood();
+                clearItems();
+                clearBombs();
+
+                for(const [_, worm] of worms){
+                    worm.clearEffects();
+                }
+
+                updateEffects();
+                updateBombs(0, 0);
+                updateFoodCounter(0, spawnFoodNeeded);
+            }
+
+            currentRound = round;
+
+            const target = targetLength > 0 ? " - first to length " + targetLength : "";
+
+            if(secondsRemaining > 0){
+                startCountdown(secondsRemaining, (time) => roundBox.textContent = "Round " + round + target + " - " + time);
+            } else{
+                clearInterval(roundIntervalId);
+                roundBox.textContent = "Round " + round + target;
+            }
+
+            roundBox.style.visibility = "visible";
+            roundEndBox.style.visibility = "hidden";
+
+            break;
+        }
+        case wsEvents.ROUNDEND: {
+            const [winnerId, winningTeam, intermissionSeconds, standingsMsg] = msg.split('|');
+
+            roundEndBox.innerHTML = "";
+
+            const title = document.createElement("h2");
+
+            if(parseInt(winningTeam) > 0){
+                title.textContent = "Team " + winningTeam + " wins!";
+            } else if(winnerId === playerId){
+                title.textContent = "You win!";
+            } else{
+                title.textContent = "Round over";
+            }
+
+            roundEndBox.appendChild(title);
+
+            if(standingsMsg){
+                const standings = document.createElement("ol");
+
+                for(const unparsedStanding of standingsMsg.split("\n")){
+                    const [id, name, team, length] = unparsedStanding.split(',');
+
+                    const standing = document.createElement("li");
+                    standing.textContent = name + " - " + length + (parseInt(team) > 0 ? " (team " + team + ")" : "");
+
+                    if(id === playerId){
+                        standing.style.fontWeight = "bold";
+                    }
+
+                    standings.appendChild(standing);
+                }
+
+                roundEndBox.appendChild(standings);
+            }
+
+            const nextRound = document.createElement("p");
+            roundEndBox.appendChild(nextRound);
+
+            startCountdown(parseInt(intermissionSeconds), (time) => nextRound.textContent = "Next round in " + time);
+
+            roundBox.style.visibility = "hidden";
+            roundEndBox.style.visibility = "visible";
+
+            break;
+        }
+        case wsEvents.ELIMINATED: {
+            if(msg === playerId){
+                noticeBox.textContent = "You were eliminated, you will play again next round";
+                noticeBox.style.visibility = "visible";
+            }
+
+            break;
+        }
+        case wsEvents.RING: {
+            const inset = parseInt(msg);
+
+            for(let y = 0; y < GRID_ROWS; y++){
+                for(let x = 0; x < GRID_COLS; x++){
+                    const outside = x < inset || x >= GRID_COLS - inset || y < inset || y >= GRID_ROWS - inset;
+                    grid.children.item(x + y * GRID_COLS).classList.toggle("outside-ring", outside);
+                }
+            }
+
+            break;
+        }
+        case wsEvents.MAP: {
+            drawWalls(msg);
+
+            break;
+        }
+        case wsEvents.SPAWNITEM: {
+            for(const [id, kind, position] of parseItems(msg)){
+                addItemToCell(position, kind);
+                items.set(id, position);
+            }
+
+            break;
+        }
+        case wsEvents.CONSUMEITEM: {
+            const [itemId, wormId, kind] = msg.split('|');
+
+            if(items.has(itemId)){
+                removeItemFromCell(items.get(itemId));
+                items.delete(itemId);
+            }
+
+            if(worms.has(wormId)){
+                worms.get(wormId).setEffect(kind, true);
+            }
+
+            if(wormId === playerId){
+                updateEffects();
+            }
+
+            break;
+        }
+        case wsEvents.EFFECTEND: {
+            for(const line of msg.split('\n')){
+                const [wormId, kind] = line.split(',');
+
+                if(worms.has(wormId)){
+                    worms.get(wormId).setEffect(kind, false);
+                }
+            }
+
+            updateEffects();
+
+            break;
+        }
+        case wsEvents.BOMBS: {
+            const [held, cooldownMilliseconds] = msg.split('|').map((n) => parseInt(n));
+            updateBombs(held, cooldownMilliseconds);
+
+            break;
+        }
+        case wsEvents.BOOST: {
+            const [id] = msg.split('|');
+
+            if(worms.has(id)){
+                worms.get(id).setEffect("BOOST", true);
+            }
+
+            if(id === playerId){
+                updateEffects();
+            }
+
+            break;
+        }
+        case wsEvents.KILL: {
+            for(const line of msg.split('\n')){
+                const [killerId, killerName, victimId, victimName, kills] = line.split('|');
+                addChatNotice(killerName + " blew up " + victimName + " (" + kills + (kills === "1" ? " kill)" : " kills)"));
+            }
+
+            break;
+        }
+        case wsEvents.INVULNERABLE: {
+            for(const line of msg.split('\n')){
+                const [id, milliseconds] = line.split(',');
+
+                if(worms.has(id)){
+                    worms.get(id).setInvulnerable(parseInt(milliseconds));
+                }
+            }
+
+            break;
+        }
+        case wsEvents.SPECTATORS: {
+            spectatorCounter.innerHTML = msg;
+
             break;
         }
         case wsEvents.NEW: {
-            const [id, positions] = parseNewEvent(msg);
+            const [wormMsg, team] = msg.split('|');
+            const [id, positions] = parseNewEvent(wormMsg);
 
             const worm = new Worm(
                 positions,
-                generateRandomColour(),
+                wormColour(parseInt(team)),
                 generateRandomColour(),
             );
 
@@ -321,19 +867,62 @@ const handleWsMsg = ({ data }) => {
             break;
         }
         case wsEvents.INIT: {
-            let [playerWormMsg, enemyWormsMsg, foodMsg, bombMsg] = msg.split('|');
+            let [playerWormMsg, enemyWormsMsg, foodMsg, bombMsg, teamsMsg, wrapEdgesMsg, wallsMsg, itemsMsg, progressMsg] = msg.split('|');
 
-            let [id, positions] = parseNewEvent(playerWormMsg);
+            grid.classList.toggle("wrap-edges", wrapEdgesMsg === "1");
+            drawWalls(wallsMsg);
 
-            const playerWorm = new Worm(
-                positions,
-                generateRandomColour(),
-                generateRandomColour(),
-            );
+            //players are sent INIT again when they rejoin after being eliminated
+            for(const [_, worm] of worms){
+                worm.clearPositions();
+            }
+
+            worms = new Map();
+            clearBombs();
+            playerId = null;
+            clearFood();
+            clearItems();
+            updateBombs(0, 0);
+            noticeBox.style.visibility = "hidden";
 
-            playerId = id;
+            const teams = new Map();
 
-            worms.set(playerId, playerWorm);
+            if(teamsMsg){
+                for(const unparsedTeam of teamsMsg.split("\n")){
+                    const [id, team] = unparsedTeam.split(',');
+                    teams.set(id, parseInt(team));
+                }
+            }
+
+            //spectators are sent INIT without a worm of their own
+            if(playerWormMsg === ""){
+                chatInput.style.display = "none";
+
+                if(!wantsToSpectate){
+                    noticeBox.textContent = "A round is in progress, you will join the next one";
+                    noticeBox.style.visibility = "visible";
+                }
+            } else{
+                chatInput.style.removeProperty("display");
+
+                let [id, positions] = parseNewEvent(playerWormMsg);
+
+                const playerWorm = new Worm(
+                    positions,
+                    wormColour(teams.get(id)),
+                    generateRandomColour(),
+                );
+
+                playerId = id;
+
+                worms.set(playerId, playerWorm);
+
+                const [consumed, needed] = progressMsg.split('/');
+                updateFoodCounter(consumed, needed);
+                updateLevel(positions.length);
+
+                progressBox.style.visibility = "visible";
+            }
 
             if(enemyWormsMsg != ""){
                 const unparsedEnemyWorms = enemyWormsMsg.split("\n");
@@ -343,7 +932,7 @@ const handleWsMsg = ({ data }) => {
 
                     const enemyWorm = new Worm(
                         positions,
-                        generateRandomColour(),
+                        wormColour(teams.get(id)),
                         generateRandomColour(),
                     );
 
@@ -352,10 +941,10 @@ const handleWsMsg = ({ data }) => {
             }
 
             if(foodMsg !== ""){
-                const foodPositions = parsePositions(foodMsg);
-
-                for(const foodPosition of foodPositions){
-                    addFoodToCell(foodPosition, generateRandomColour());
+                for(const [kind, foodPositions] of parseFood(foodMsg)){
+                    for(const foodPosition of foodPositions){
+                        addFoodToCell(foodPosition, kind);
+                    }
                 }
             }
 
@@ -366,9 +955,10 @@ const handleWsMsg = ({ data }) => {
                     const bombData = unparsedBomb.split(',');
 
                     const id = bombData[0];
-                    const timeToDetonateSeconds = bombData[1];
-                    const unparsedBombPosition = bombData[2];
-                    const unparsedPositions = bombData.slice(3);
+                    const type = bombData[1];
+                    const timeToDetonateSeconds = bombData[2];
+                    const unparsedBombPosition = bombData[3];
+                    const unparsedPositions = bombData.slice(4);
 
                     const positions = [];
 
@@ -376,13 +966,21 @@ const handleWsMsg = ({ data }) => {
                         positions.push(parsePosition(unparsedPosition));
                     }
 
-                    const bomb = new Bomb(parsePosition(unparsedBombPosition), positions, parseInt(timeToDetonateSeconds));
+                    const bomb = new Bomb(parsePosition(unparsedBombPosition), positions, parseInt(timeToDetonateSeconds), type);
                     bombs.set(id, bomb);
                 }
             }
 
+            if(itemsMsg){
+                for(const [id, kind, position] of parseItems(itemsMsg)){
+                    addItemToCell(position, kind);
+                    items.set(id, position);
+                }
+            }
+
+            updateEffects();
+
             loading.style.visibility = "hidden";
-            progressBox.style.visibility = "visible";
 
             isInitialised = true;
 
@@ -402,6 +1000,7 @@ const init = () => {
     );
 
     const wsUrl = new URL(document.URL);
+    wsUrl.protocol = WS_PROTOCOL;
     wsUrl.port = WS_PORT;
 
     ws = new WebSocket(wsUrl);
@@ -409,11 +1008,40 @@ const init = () => {
     ws.onopen = () => {
         ws.send("INIT");
 
+        chatInput.addEventListener("keydown", (event) => {
+            //stop the arrow keys from steering while typing
+            event.stopPropagation();
+
+            if(event.key === "Enter" && chatInput.value.trim() !== ""){
+                ws.send(wsEvents.CHAT + "\n" + chatInput.value.trim());
+                chatInput.value = "";
+            }
+
+            if(event.key === "Enter" || event.key === "Escape"){
+                chatInput.blur();
+            }
+        });
+
         addEventListener("keydown", ({ key, repeat }) => {
             if(repeat){
                 return;
             }
 
+            if(key === "Enter" && isInitialised && playerId){
+                chatInput.focus();
+                return;
+            }
+
+            if(key in BOMB_KEYS && isInitialised && playerId){
+                ws.send(wsEvents.DROPBOMB + "\n" + BOMB_KEYS[key]);
+                return;
+            }
+
+            if(key === "Shift" && isInitialised && playerId){
+                ws.send(wsEvents.BOOST);
+                return;
+            }
+
             let dir = null;
 
             switch(key){
@@ -433,6 +1061,8 @@ const init = () => {
                     return;
             }
 
+            idleBox.style.visibility = "hidden";
+
             ws.send(wsEvents.CHANGEDIR + "\n" + dir);
         });
     };
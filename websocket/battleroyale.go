@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	defaultRingShrinkInterval = 15 * time.Second
+	ringDamageInterval        = 1 * time.Second
+	minRingSize               = 6
+)
+
+// battleRoyaleInProgress must be called with server.mu held.
+func (server *Server) battleRoyaleInProgress() bool {
+	return server.config.BattleRoyale && server.roundInProgress
+}
+
+// outsideRing reports whether position has been closed off by the shrinking
+// ring. It must be called with server.mu held.
+func (server *Server) outsideRing(position pos) bool {
+	inset := server.ringInset
+
+	return position.x < inset || position.x >= server.gridWidth-inset || position.y < inset || position.y >= server.gridHeight-inset
+}
+
+func (server *Server) ringMsg() []byte {
+	return []byte(eventRing + "\n" + strconv.Itoa(server.ringInset))
+}
+
+// eliminate takes worm off the grid, it is removed from the game by
+// removeEliminated. It must be called with server.mu held.
+func (server *Server) eliminate(id string, worm *worm) {
+	for _, position := range worm.positions {
+		server.vacate(id, position)
+	}
+
+	worm.eliminated = true
+}
+
+// removeEliminated leaves eliminated players spectating until the next round.
+func (server *Server) removeEliminated() {
+	server.mu.Lock()
+
+	eliminatedIds := []string{}
+
+	for ws, id := range server.wormConns {
+		worm := server.worms[id]
+
+		if !worm.eliminated {
+			continue
+		}
+
+		server.eliminated = append(server.eliminated, standing{id, worm.displayName(id), worm.team, 1})
+
+		server.removeWorm(ws, id)
+		server.spectators[ws] = true
+		server.waitingForRound[ws] = true
+
+		eliminatedIds = append(eliminatedIds, id)
+	}
+
+	server.mu.Unlock()
+
+	for _, id := range eliminatedIds {
+		server.broadcast([]byte(eventEliminated + "\n" + id))
+		server.broadcast([]byte(eventDisconnect + "\n" + id))
+	}
+
+	if len(eliminatedIds) > 0 {
+		server.broadcast(server.spectatorCountMsg())
+	}
+}
+
+// rejoinWaiting gives a worm to everyone who was eliminated or joined during
+// the last round, those there is no room for, or who would go over MaxPlayers,
+// wait for the next. It must be called with server.mu held.
+func (server *Server) rejoinWaiting() map[*websocket.Conn]string {
+	rejoined := map[*websocket.Conn]string{}
+
+	for ws := range server.waitingForRound {
+		id, added := server.addPlayer(ws)
+
+		if !added {
+			continue
+		}
+
+		delete(server.spectators, ws)
+		delete(server.waitingForRound, ws)
+
+		rejoined[ws] = id
+	}
+
+	server.eliminated = nil
+	server.ringInset = 0
+
+	return rejoined
+}
+
+// tickBattleRoyale shrinks the ring on schedule and damages worms outside of
+// it, one length for every cell outside like a bomb blast.
+func (server *Server) tickBattleRoyale() {
+	server.mu.Lock()
+
+	if !server.battleRoyaleInProgress() {
+		server.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	shrinkInterval := server.config.RingShrinkInterval
+
+	if shrinkInterval <= 0 {
+		shrinkInterval = defaultRingShrinkInterval
+	}
+
+	ringChanged := false
+
+	if now.Sub(server.lastRingShrink) >= shrinkInterval {
+		server.lastRingShrink = now
+
+		if server.gridWidth-2*(server.ringInset+1) >= minRingSize && server.gridHeight-2*(server.ringInset+1) >= minRingSize {
+			server.ringInset++
+			ringChanged = true
+		}
+	}
+
+	damageMap := map[string]int{}
+
+	if now.Sub(server.lastRingDamage) >= ringDamageInterval {
+		server.lastRingDamage = now
+
+		for id, worm := range server.worms {
+			for _, position := range worm.positions {
+				if server.outsideRing(position) {
+					damageMap[id]++
+				}
+			}
+		}
+	}
+
+	ringMsg := server.ringMsg()
+
+	server.mu.Unlock()
+
+	if ringChanged {
+		server.broadcast(ringMsg)
+	}
+
+	if len(damageMap) == 0 {
+		return
+	}
+
+	wormsMsg := ""
+
+	for id, damage := range damageMap {
+		server.mu.RLock()
+		worm := server.worms[id]
+		server.mu.RUnlock()
+
+		//a blast may have eliminated and removed it since the ring damage was counted
+		if worm == nil {
+			continue
+		}
+
+		server.reduce(id, worm, damage)
+
+		if wormsMsg != "" {
+			wormsMsg += "\n"
+		}
+
+		wormsMsg += id + "," + positionsToString(worm.positions)
+	}
+
+	if wormsMsg != "" {
+		server.broadcast([]byte(eventMove + "\n" + wormsMsg))
+	}
+
+	server.removeEliminated()
+}
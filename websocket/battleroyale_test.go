@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestRejoinWaitingRespectsMaxPlayers(t *testing.T) {
+	server := newTestServer(t, 30, 30, Config{BattleRoyale: true, MaxPlayers: 2})
+
+	playing := dialTestConn(t, "name=playing")
+
+	if _, added := server.addPlayer(playing); !added {
+		t.Fatal("the first player was not added")
+	}
+
+	waiting := []*websocket.Conn{dialTestConn(t, "name=first"), dialTestConn(t, "name=second")}
+
+	for _, ws := range waiting {
+		server.spectators[ws] = true
+		server.waitingForRound[ws] = true
+	}
+
+	rejoined := server.rejoinWaiting()
+
+	if len(rejoined) != 1 || len(server.worms) != 2 {
+		t.Fatalf("%d players rejoined with %d worms in the game, expected 1 and 2", len(rejoined), len(server.worms))
+	}
+
+	if len(server.waitingForRound) != 1 || len(server.spectators) != 1 {
+		t.Fatal("the player over the cap should keep waiting for the next round")
+	}
+}
+
+func TestBattleRoyalePlaysRounds(t *testing.T) {
+	server := newTestServer(t, 30, 30, Config{BattleRoyale: true})
+
+	if !server.roundsEnabled() {
+		t.Fatal("battle royale without a round duration or target should still play rounds")
+	}
+}
+
+func TestWaitingPlayersStartTheNextRound(t *testing.T) {
+	server := newTestServer(t, 30, 30, Config{BattleRoyale: true})
+
+	if server.hasPlayers() {
+		t.Fatal("an empty server should not have players")
+	}
+
+	//the last worm was eliminated, leaving its player waiting with no one playing
+	ws := dialTestConn(t, "name=eliminated")
+	server.spectators[ws] = true
+	server.waitingForRound[ws] = true
+
+	if !server.hasPlayers() {
+		t.Fatal("a player waiting to rejoin should count towards starting a round")
+	}
+
+	server.startRound()
+
+	if _, playing := server.wormConns[ws]; !playing || len(server.waitingForRound) != 0 {
+		t.Fatal("the waiting player should rejoin when the round starts")
+	}
+}
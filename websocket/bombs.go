@@ -0,0 +1,187 @@
+package websocket
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Kinds of bomb, sent as the TYPE of SPAWNBOMB and DETBOMB.
+const (
+	// bombSquare blasts every cell within its radius.
+	bombSquare = "SQUARE"
+	// bombLine blasts the row and column through its center, further than its
+	// radius.
+	bombLine = "LINE"
+	// bombCluster scatters smaller bombs around itself when it detonates.
+	bombCluster = "CLUSTER"
+	// bombMine is hidden from everyone but its owner and detonates once another
+	// worm runs over it.
+	bombMine = "MINE"
+)
+
+const (
+	lineBombReachPerRadius           = 3
+	clusterBombs                     = 4
+	clusterBombDetonationTimeSeconds = 2
+	mineArmTime                      = 2 * time.Second
+	mineDetonationTimeSeconds        = 30
+)
+
+var bombKinds = map[string]bool{
+	bombSquare:  true,
+	bombLine:    true,
+	bombCluster: true,
+	bombMine:    true,
+}
+
+// visibleTo reports whether the player owning the worm id, empty for
+// spectators, is shown bomb. Mines are hidden from everyone but whoever laid
+// them, so spectators never see them, nor the mines the server spawns.
+func (bomb *bomb) visibleTo(id string) bool {
+	return bomb.kind != bombMine || (id != "" && bomb.owner == id)
+}
+
+// randomBombKind picks the kind of a bomb spawned by the server.
+func randomBombKind() string {
+	switch n := rand.Intn(20); {
+	case n < 10:
+		return bombSquare
+	case n < 15:
+		return bombLine
+	case n < 18:
+		return bombCluster
+	default:
+		return bombMine
+	}
+}
+
+// bombDetonationTimeSeconds returns how long a bomb of kind takes to detonate
+// by itself, mines wait much longer for a worm to set them off.
+func bombDetonationTimeSeconds(kind string, detonationTimeSeconds int) int {
+	if kind == bombMine {
+		return mineDetonationTimeSeconds
+	}
+
+	return detonationTimeSeconds
+}
+
+// blastPositions returns the cells hit by a bomb of kind at x, y.
+func (server *Server) blastPositions(kind string, x int, y int, radius int) []pos {
+	if kind == bombLine {
+		reach := radius * lineBombReachPerRadius
+		positions := []pos{{x, y}}
+
+		for distance := 1; distance <= reach; distance++ {
+			for _, position := range []pos{{x - distance, y}, {x + distance, y}, {x, y - distance}, {x, y + distance}} {
+				if server.config.WrapEdges {
+					position = server.wrap(position)
+				} else if position.x < 0 || position.x >= server.gridWidth || position.y < 0 || position.y >= server.gridHeight {
+					continue
+				}
+
+				//a long blast on a small wrapping grid comes back round to itself
+				if !containsPos(positions, position) {
+					positions = append(positions, position)
+				}
+			}
+		}
+
+		return positions
+	}
+
+	var bombPositions []pos
+
+	if server.config.WrapEdges {
+		//the blast carries on around the edges of the grid
+		bombPositions = make([]pos, 0, (2*radius+1)*(2*radius+1))
+
+		for curX := x - radius; curX <= x+radius; curX++ {
+			for curY := y - radius; curY <= y+radius; curY++ {
+				bombPositions = append(bombPositions, server.wrap(pos{curX, curY}))
+			}
+		}
+	} else {
+		lowX := int(math.Max(0, float64(x-radius)))
+		highX := int(math.Min(float64(server.gridWidth-1), float64(x+radius)))
+
+		lowY := int(math.Max(0, float64(y-radius)))
+		highY := int(math.Min(float64(server.gridHeight-1), float64(y+radius)))
+
+		width := highX - lowX + 1
+		height := highY - lowY + 1
+
+		bombPositions = make([]pos, width*height)
+
+		index := 0
+
+		for curX := lowX; curX <= highX; curX++ {
+			for curY := lowY; curY <= highY; curY++ {
+				bombPositions[index] = pos{curX, curY}
+				index++
+			}
+		}
+	}
+
+	return bombPositions
+}
+
+// triggerBomb sets bomb off now if it hasn't been already. It must be called
+// with server.mu held.
+func (server *Server) triggerBomb(bomb *bomb) {
+	if !bomb.triggered {
+		bomb.triggered = true
+		close(bomb.trigger)
+	}
+}
+
+// defuseBombs takes every pending bomb off the board without detonating them.
+// It must be called with server.mu held.
+func (server *Server) defuseBombs() {
+	for _, bomb := range server.bombs {
+		bomb.defused = true
+		server.triggerBomb(bomb)
+	}
+
+	server.bombs = map[string]*bomb{}
+}
+
+// chainReaction sets off every other bomb whose center is in bomb's blast. It
+// must be called with server.mu held.
+func (server *Server) chainReaction(bomb *bomb) {
+	for _, other := range server.bombs {
+		if other != bomb && containsPos(bomb.positions, other.bombPosition) {
+			server.triggerBomb(other)
+		}
+	}
+}
+
+// triggerMines sets off the armed mines the worm id has run over at position.
+// It must be called with server.mu held.
+func (server *Server) triggerMines(id string, position pos) {
+	for _, bomb := range server.bombs {
+		if bomb.kind == bombMine && bomb.bombPosition == position && bomb.owner != id && time.Since(bomb.placed) >= mineArmTime {
+			server.triggerBomb(bomb)
+		}
+	}
+}
+
+// scatterCluster places the smaller bombs a cluster bomb at center leaves
+// behind, within twice its radius.
+func (server *Server) scatterCluster(center pos, radius int, owner string) {
+	for i := 0; i < clusterBombs; i++ {
+		position := pos{
+			center.x + rand.Intn(4*radius+1) - 2*radius,
+			center.y + rand.Intn(4*radius+1) - 2*radius,
+		}
+
+		if server.config.WrapEdges {
+			position = server.wrap(position)
+		} else {
+			position.x = min(max(position.x, 0), server.gridWidth-1)
+			position.y = min(max(position.y, 0), server.gridHeight-1)
+		}
+
+		go server.placeBomb(position.x, position.y, bombSquare, 1, clusterBombDetonationTimeSeconds, owner)
+	}
+}
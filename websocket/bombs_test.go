@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefusedBombsDoNotDetonate(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{})
+	worm := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+
+	done := make(chan struct{})
+
+	go func() {
+		server.placeBomb(4, 5, bombSquare, 1, 1, "")
+		close(done)
+	}()
+
+	//wait for the bomb to be placed before clearing the board
+	for {
+		server.mu.RLock()
+		placed := len(server.bombs)
+		server.mu.RUnlock()
+
+		if placed > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	server.mu.Lock()
+	server.defuseBombs()
+	server.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the defused bomb is still pending")
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	if len(worm.positions) != 3 {
+		t.Fatalf("the worm was hurt by a defused bomb, its length is %d", len(worm.positions))
+	}
+
+	if len(server.bombs) != 0 {
+		t.Fatal("the defused bomb was left on the board")
+	}
+}
+
+func TestBombVisibleTo(t *testing.T) {
+	tests := []struct {
+		name  string
+		bomb  bomb
+		id    string
+		shown bool
+	}{
+		{"server bomb to a player", bomb{kind: bombSquare}, "1", true},
+		{"server bomb to a spectator", bomb{kind: bombSquare}, "", true},
+		{"mine to its owner", bomb{kind: bombMine, owner: "1"}, "1", true},
+		{"mine to another player", bomb{kind: bombMine, owner: "1"}, "2", false},
+		{"mine to a spectator", bomb{kind: bombMine, owner: "1"}, "", false},
+		{"server mine to a player", bomb{kind: bombMine}, "1", false},
+		{"server mine to a spectator", bomb{kind: bombMine}, "", false},
+	}
+
+	for _, test := range tests {
+		if shown := test.bomb.visibleTo(test.id); shown != test.shown {
+			t.Errorf("%s: visibleTo(%q) = %v, expected %v", test.name, test.id, shown, test.shown)
+		}
+	}
+}
+
+func TestBlastSkipsRemovedWorms(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{})
+	worm := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+
+	//another blast eliminated the worm after this one saw it on the grid
+	delete(server.worms, "1")
+
+	server.placeBomb(4, 5, bombSquare, 1, 0, "")
+
+	if len(worm.positions) != 3 {
+		t.Fatalf("the removed worm was hurt, its length is %d", len(worm.positions))
+	}
+}
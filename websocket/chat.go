@@ -0,0 +1,247 @@
+package websocket
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	maxChatLength = 200
+	maxNameLength = 16
+	chatRate      = 1
+	chatBurst     = 3
+	// defaultMuteDuration is how long a mute lasts when an admin gives no duration.
+	defaultMuteDuration = time.Hour
+)
+
+// ChatFilter checks a chat message before it is broadcast, returning the text
+// to send, eg. with words masked, and false if it should be dropped.
+type ChatFilter func(text string) (string, bool)
+
+func toLowerRunes(text string) []rune {
+	runes := []rune(text)
+
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+
+	return runes
+}
+
+// NewWordFilter returns a ChatFilter that masks each of words, ignoring case.
+func NewWordFilter(words []string) ChatFilter {
+	lowerWords := [][]rune{}
+
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+
+		if word != "" {
+			lowerWords = append(lowerWords, toLowerRunes(word))
+		}
+	}
+
+	return func(text string) (string, bool) {
+		runes := []rune(text)
+		lowerRunes := toLowerRunes(text)
+
+		for _, word := range lowerWords {
+			for i := 0; i+len(word) <= len(lowerRunes); i++ {
+				if string(lowerRunes[i:i+len(word)]) == string(word) {
+					for j := i; j < i+len(word); j++ {
+						runes[j] = '*'
+					}
+				}
+			}
+		}
+
+		return string(runes), true
+	}
+}
+
+func validChatMessage(text string) bool {
+	if text == "" || !utf8.ValidString(text) || utf8.RuneCountInString(text) > maxChatLength {
+		return false
+	}
+
+	for _, r := range text {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// playerName is the name a connection asked for with a name query parameter,
+// stripped of characters used by the protocol.
+func playerName(ws *websocket.Conn) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '|' || r == ',' {
+			return -1
+		}
+
+		return r
+	}, strings.TrimSpace(ws.Request().URL.Query().Get("name")))
+
+	if utf8.RuneCountInString(name) > maxNameLength {
+		name = string([]rune(name)[:maxNameLength])
+	}
+
+	return name
+}
+
+func (server *Server) handleChat(initiator *websocket.Conn, initiatorId string, text string) {
+	server.mu.RLock()
+
+	worm, ok := server.worms[initiatorId]
+
+	if !ok {
+		server.mu.RUnlock()
+		return
+	}
+
+	name := worm.displayName(initiatorId)
+	muted := server.isMuted(server.connIPs[initiator])
+
+	server.mu.RUnlock()
+
+	if server.config.ChatFilter != nil {
+		filtered, ok := server.config.ChatFilter(text)
+
+		if !ok {
+			return
+		}
+
+		text = filtered
+	}
+
+	msg := []byte(eventChat + "\n" + initiatorId + "|" + name + "|" + text)
+
+	//muted messages are kept for moderators looking back over the game
+	if muted {
+		server.record(msg, true)
+		initiator.Write([]byte(eventError + "\n" + errorMuted))
+
+		return
+	}
+
+	server.broadcast(msg)
+}
+
+// isMuted reports whether players connecting from ip are muted. It must be
+// called with server.mu held.
+func (server *Server) isMuted(ip string) bool {
+	mutedUntil, muted := server.muted[ip]
+
+	return muted && time.Now().Before(mutedUntil)
+}
+
+// pruneMutes forgets mutes that have run out. It must be called with
+// server.mu held.
+func (server *Server) pruneMutes() {
+	for ip, mutedUntil := range server.muted {
+		if !time.Now().Before(mutedUntil) {
+			delete(server.muted, ip)
+		}
+	}
+}
+
+// muteTarget returns the address given by the ip form value, or that the player
+// owning the worm given by the id form value connected from. Mutes are kept by
+// address so players can't escape them by reconnecting. It must be called with
+// server.mu held.
+func (server *Server) muteTarget(r *http.Request) (string, bool) {
+	if ip := r.FormValue("ip"); ip != "" {
+		return ip, true
+	}
+
+	id := r.FormValue("id")
+
+	for ws, wormId := range server.wormConns {
+		if wormId == id {
+			ip, ok := server.connIPs[ws]
+			return ip, ok
+		}
+	}
+
+	return "", false
+}
+
+// handleMute lets an admin mute the player given by the id or ip form value,
+// for a duration form value such as 10m or defaultMuteDuration if it is omitted.
+func (server *Server) handleMute(w http.ResponseWriter, r *http.Request) {
+	if !server.isAdmin(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	duration := defaultMuteDuration
+
+	if durationStr := r.FormValue("duration"); durationStr != "" {
+		var error error
+		duration, error = time.ParseDuration(durationStr)
+
+		if error != nil || duration <= 0 {
+			http.Error(w, "invalid duration", http.StatusBadRequest)
+			return
+		}
+	}
+
+	server.mu.Lock()
+
+	ip, ok := server.muteTarget(r)
+
+	if ok {
+		server.muted[ip] = time.Now().Add(duration)
+	}
+
+	server.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "unknown player", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) handleUnmute(w http.ResponseWriter, r *http.Request) {
+	if !server.isAdmin(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	server.mu.Lock()
+
+	ip, ok := server.muteTarget(r)
+
+	if ok {
+		delete(server.muted, ip)
+	}
+
+	server.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "unknown player", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isAdmin checks for an Authorization: Bearer header matching the AdminToken.
+func (server *Server) isAdmin(r *http.Request) bool {
+	if server.config.AdminToken == "" {
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(server.config.AdminToken)) == 1
+}
@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestNewWordFilter(t *testing.T) {
+	filter := NewWordFilter([]string{"darn", " Heck ", ""})
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"hello", "hello"},
+		{"darn it", "**** it"},
+		{"DARN and heck", "**** and ****"},
+		{"darndarn", "********"},
+		{"héck darn", "héck ****"},
+	}
+
+	for _, test := range tests {
+		got, ok := filter(test.text)
+
+		if !ok || got != test.want {
+			t.Errorf("filter(%q) = %q, %v, expected %q", test.text, got, ok, test.want)
+		}
+	}
+}
+
+func TestValidChatMessage(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"hello everyone", true},
+		{"", false},
+		{strings.Repeat("a", maxChatLength), true},
+		{strings.Repeat("a", maxChatLength+1), false},
+		{strings.Repeat("é", maxChatLength), true},
+		{"line\nbreak", false},
+		{"bad \xff utf8", false},
+	}
+
+	for _, test := range tests {
+		if got := validChatMessage(test.text); got != test.want {
+			t.Errorf("validChatMessage(%q) = %v, expected %v", test.text, got, test.want)
+		}
+	}
+}
+
+func adminRequest(path string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer secret")
+
+	return r
+}
+
+func TestMutesOutlastReconnecting(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{AdminToken: "secret"})
+
+	ws := &websocket.Conn{}
+	server.wormConns[ws] = "1"
+	server.connIPs[ws] = "192.0.2.1"
+
+	w := httptest.NewRecorder()
+	server.handleMute(w, adminRequest("/admin/mute", url.Values{"id": {"1"}, "duration": {"10m"}}))
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("mute returned %d", w.Code)
+	}
+
+	//the player comes back with a new connection and worm
+	delete(server.wormConns, ws)
+	delete(server.connIPs, ws)
+
+	reconnected := &websocket.Conn{}
+	server.wormConns[reconnected] = "2"
+	server.connIPs[reconnected] = "192.0.2.1"
+
+	if !server.isMuted(server.connIPs[reconnected]) {
+		t.Fatal("reconnecting lifted the mute")
+	}
+
+	w = httptest.NewRecorder()
+	server.handleUnmute(w, adminRequest("/admin/unmute", url.Values{"id": {"2"}}))
+
+	if w.Code != http.StatusNoContent || server.isMuted("192.0.2.1") {
+		t.Fatalf("unmute returned %d and left the address muted", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleMute(w, adminRequest("/admin/mute", url.Values{"id": {"99"}}))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("muting an unknown player returned %d", w.Code)
+	}
+}
+
+func TestPruneMutes(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{})
+	server.muted = map[string]time.Time{
+		"192.0.2.1": time.Now().Add(-time.Second),
+		"192.0.2.2": time.Now().Add(time.Minute),
+	}
+
+	server.pruneMutes()
+
+	if _, ok := server.muted["192.0.2.1"]; ok {
+		t.Error("an expired mute was kept")
+	}
+
+	if !server.isMuted("192.0.2.2") {
+		t.Error("a running mute was pruned")
+	}
+}
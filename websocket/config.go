@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"io"
+	"time"
+	"wormo/gamemap"
+)
+
+// Rules for worms running into their own teammates.
+const (
+	// FriendlyFireBounce turns a worm away from its teammate without either
+	// losing length.
+	FriendlyFireBounce = "bounce"
+	// FriendlyFirePass lets worms slide over their teammates.
+	FriendlyFirePass = "pass"
+)
+
+// Actions taken against a player once they have been idle for IdleActionAfter.
+const (
+	// IdleActionKick closes the player's connection.
+	IdleActionKick = "kick"
+	// IdleActionBot steers the player's worm until they send input again.
+	IdleActionBot = "bot"
+	// IdleActionSpectate removes the player's worm, leaving them spectating.
+	IdleActionSpectate = "spectate"
+)
+
+// Config holds the rules a game server is run with. The zero value of each
+// field keeps the original unrestricted behaviour.
+type Config struct {
+	// AllowedOrigins lists the origins, eg. https://wormo.example, that may open
+	// a connection. Any origin is accepted when empty.
+	AllowedOrigins []string
+	// MaxConnsPerIP caps the simultaneous connections from one address, 0 for no cap.
+	MaxConnsPerIP int
+	// MaxPlayers caps the number of worms in the game, 0 for no cap.
+	MaxPlayers int
+	// QueueWhenFull keeps connections waiting for a free slot once MaxPlayers
+	// is reached instead of closing them.
+	QueueWhenFull bool
+	// MaxMessageSize caps the size in bytes of a client message, 0 for
+	// defaultMaxMessageSize. Larger messages are rejected with an ERROR.
+	MaxMessageSize int
+	// IdleActionAfter is how long a player can go without changing direction
+	// before IdleAction is taken, 0 disables idle detection.
+	IdleActionAfter time.Duration
+	// IdleWarnAfter is how long a player can go without changing direction
+	// before being warned with IDLE, 0 for no warning.
+	IdleWarnAfter time.Duration
+	// IdleAction is one of IdleActionKick, IdleActionBot or IdleActionSpectate.
+	IdleAction string
+	// ChatFilter is run on every chat message before it is broadcast, nil to
+	// send messages unchanged.
+	ChatFilter ChatFilter
+	// AdminToken must be sent as a bearer token to the /admin endpoints, which
+	// are disabled when it is empty.
+	AdminToken string
+	// Teams splits worms evenly into this many teams as they join, 0 for
+	// everyone for themselves.
+	Teams int
+	// FriendlyFire is one of FriendlyFireBounce or FriendlyFirePass.
+	FriendlyFire string
+	// RoundDuration ends each round after this long, 0 for no time limit.
+	RoundDuration time.Duration
+	// RoundTargetLength ends each round once a worm grows this long, 0 for no
+	// target. Rounds are only played when this or RoundDuration is set.
+	RoundTargetLength int
+	// Intermission is the pause between a round ending and the next starting.
+	Intermission time.Duration
+	// BattleRoyale eliminates worms reduced to length 1 until the last one
+	// standing wins the round, while the playable area shrinks. Players who
+	// join mid round wait for the next one. Rounds are always played, without
+	// RoundDuration or RoundTargetLength they only end with the last worm standing.
+	BattleRoyale bool
+	// RingShrinkInterval is how often the playable area shrinks by a cell on
+	// each side in BattleRoyale, 0 for defaultRingShrinkInterval.
+	RingShrinkInterval time.Duration
+	// WrapEdges makes worms and bomb blasts that leave one side of the grid
+	// come back in on the opposite side instead of hitting the edge.
+	WrapEdges bool
+	// Map lays out walls, spawn zones and food-rich regions, nil for an open
+	// grid. Its size takes the place of the size given to NewServer.
+	Map *gamemap.Map
+	// MapGenerator, one of gamemap.GeneratorMaze or gamemap.GeneratorCave,
+	// generates a fresh Map from MapSeed for each round after the first.
+	MapGenerator string
+	// MapSeed is the seed the first round's Map was generated with, each
+	// round after is generated with MapSeed plus the round number.
+	MapSeed int64
+	// ItemInterval is how often items giving worms speed, a shield, ghosting or
+	// a food magnet may spawn, 0 for no items.
+	ItemInterval time.Duration
+	// FoodPerBomb is how much food a worm must eat to earn a bomb it can drop
+	// with DROPBOMB, 0 for no player bombs.
+	FoodPerBomb int
+	// BombCooldown is how long a worm must wait between dropping bombs, 0 for
+	// defaultBombCooldown.
+	BombCooldown time.Duration
+	// SlowdownFromLength slows worms longer than this down, the longer the
+	// slower, 0 for every worm moving at the same speed.
+	SlowdownFromLength int
+	// BoostCost is how much length a worm spends to double its speed for a
+	// while with BOOST, 0 to disable boosting.
+	BoostCost int
+	// FoodWeights sets how likely each kind of food, eg. FoodGolden, is to
+	// spawn relative to the others. Only FoodCommon spawns when it is empty.
+	FoodWeights map[string]int
+	// FoodExpiry removes food left uneaten for this long, 0 for food that lasts
+	// forever.
+	FoodExpiry time.Duration
+	// LevelCurve sets how much food worms must eat to grow at each length, nil
+	// for their length times the level multiplier given to NewServer.
+	LevelCurve LevelCurve
+	// Replay records every event broadcast to the game, along with chat from
+	// muted players, as JSON lines, nil for no replay.
+	Replay io.Writer
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Kinds of food, sent with SPAWNFOOD, CONSUMEFOOD and INIT.
+const (
+	// FoodCommon is worth one towards a worm's next length.
+	FoodCommon = "COMMON"
+	// FoodGolden is rarer and worth several.
+	FoodGolden = "GOLDEN"
+	// FoodPoison shrinks the worm that eats it.
+	FoodPoison = "POISON"
+)
+
+// foodValues is how much each kind of food counts towards a worm's next
+// length, negative values take length away instead.
+var foodValues = map[string]int{
+	FoodCommon: 1,
+	FoodGolden: 3,
+	FoodPoison: -1,
+}
+
+const foodDecayCheckInterval = time.Second
+
+// ValidFoodKind reports whether kind is one of the kinds of food.
+func ValidFoodKind(kind string) bool {
+	_, ok := foodValues[kind]
+
+	return ok
+}
+
+// randomFoodKind picks the kind of a new food by FoodWeights.
+func (server *Server) randomFoodKind() string {
+	total := 0
+
+	for _, weight := range server.config.FoodWeights {
+		total += weight
+	}
+
+	if total <= 0 {
+		return FoodCommon
+	}
+
+	n := rand.Intn(total)
+
+	for kind, weight := range server.config.FoodWeights {
+		if n < weight {
+			return kind
+		}
+
+		n -= weight
+	}
+
+	return FoodCommon
+}
+
+// placeFood must be called with server.mu held.
+func (server *Server) placeFood(position pos, kind string) {
+	cell := &server.grid[position.x][position.y]
+
+	cell.food = true
+	cell.foodKind = kind
+	cell.foodExpires = time.Time{}
+
+	if server.config.FoodExpiry > 0 {
+		cell.foodExpires = time.Now().Add(server.config.FoodExpiry)
+	}
+}
+
+// foodMsg lists the food at positions with a line for each kind. It must be
+// called with server.mu held.
+func (server *Server) foodMsg(positions []pos) string {
+	var kinds []string
+	byKind := map[string][]pos{}
+
+	for _, position := range positions {
+		kind := server.grid[position.x][position.y].foodKind
+
+		if _, ok := byKind[kind]; !ok {
+			kinds = append(kinds, kind)
+		}
+
+		byKind[kind] = append(byKind[kind], position)
+	}
+
+	msg := ""
+
+	for _, kind := range kinds {
+		if msg != "" {
+			msg += "\n"
+		}
+
+		msg += kind + "," + positionsToString(byKind[kind])
+	}
+
+	return msg
+}
+
+// startFoodDecay removes food that has been left on the grid for FoodExpiry.
+func (server *Server) startFoodDecay() {
+	ticker := time.NewTicker(foodDecayCheckInterval)
+
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var decayed []pos
+
+		server.mu.Lock()
+
+		now := time.Now()
+
+		for x := 0; x < server.gridWidth; x++ {
+			for y := 0; y < server.gridHeight; y++ {
+				cell := &server.grid[x][y]
+
+				if cell.food && !cell.foodExpires.IsZero() && now.After(cell.foodExpires) {
+					cell.food = false
+					cell.foodKind = ""
+					decayed = append(decayed, pos{x, y})
+				}
+			}
+		}
+
+		server.mu.Unlock()
+
+		if len(decayed) > 0 {
+			server.broadcast([]byte(eventFoodDecay + "\n" + positionsToString(decayed)))
+		}
+	}
+}
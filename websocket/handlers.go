@@ -1,10 +1,12 @@
 package websocket
 
 import (
+	"errors"
 	"io"
 	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
@@ -20,18 +22,77 @@ const (
 	eventExtend          = "EXTEND"
 	eventChangeDirection = "CHANGEDIR"
 	eventDisconnect      = "DISCONNECT"
+	eventFull            = "FULL"
+	eventError           = "ERROR"
+	eventPing            = "PING"
+	eventPong            = "PONG"
+	eventIdle            = "IDLE"
+	eventSpectators      = "SPECTATORS"
+	eventChat            = "CHAT"
+	eventScores          = "SCORES"
+	eventRoundStart      = "ROUNDSTART"
+	eventRoundEnd        = "ROUNDEND"
+	eventEliminated      = "ELIMINATED"
+	eventRing            = "RING"
+	eventMap             = "MAP"
+	eventInvulnerable    = "INVULNERABLE"
+	eventSpawnItem       = "SPAWNITEM"
+	eventConsumeItem     = "CONSUMEITEM"
+	eventEffectEnd       = "EFFECTEND"
+	eventDropBomb        = "DROPBOMB"
+	eventBombs           = "BOMBS"
+	eventKill            = "KILL"
+	eventBoost           = "BOOST"
+	eventFoodDecay       = "FOODDECAY"
+	eventLevelUp         = "LEVELUP"
+	eventCollide         = "COLLIDE"
+)
+
+const (
+	pingInterval = 15 * time.Second
+	//connections that send nothing, not even a PONG, for this long are dropped
+	readTimeout = 2*pingInterval + 5*time.Second
 )
 
 func (server *Server) handleChangeDir(initiatorId string, dir string) {
 	server.mu.Lock()
-	server.worms[initiatorId].direction = dir
+
+	//the worm may have been removed while its connection is still open
+	worm, ok := server.worms[initiatorId]
+
+	if !ok {
+		server.mu.Unlock()
+		return
+	}
+
+	worm.queueDirection(dir)
+	worm.lastInput = time.Now()
+	worm.idleWarned = false
+	worm.idleActionTaken = false
+
 	server.mu.Unlock()
 }
 
+// handleInit sends initiator the state of the game. Spectators have an empty
+// initiatorId and are not announced to other players.
 func (server *Server) handleInit(initiator *websocket.Conn, initiatorId string) {
+	server.mu.RLock()
+
+	//a worm removed since the event was read leaves its player watching
+	if _, ok := server.worms[initiatorId]; !ok {
+		initiatorId = ""
+	}
+
+	server.mu.RUnlock()
+
 	msg := eventInit + "\n"
 
-	newWormMsg := initiatorId + "," + positionsToString(server.worms[initiatorId].positions)
+	newWormMsg := ""
+
+	if initiatorId != "" {
+		newWormMsg = initiatorId + "," + positionsToString(server.worms[initiatorId].positions)
+	}
+
 	msg += newWormMsg
 
 	existingWormsMsg := ""
@@ -48,29 +109,33 @@ func (server *Server) handleInit(initiator *websocket.Conn, initiatorId string)
 		msg += "|"
 	}
 
-	foodPositionsMsg := ""
+	var foodPositions []pos
+
+	server.mu.RLock()
 
 	//find faster way of doing this
 	for x := 0; x < server.gridWidth; x++ {
 		for y := 0; y < server.gridHeight; y++ {
 			if server.grid[x][y].food {
-				foodPositionsMsg += positionToString(&pos{x, y}) + ","
+				foodPositions = append(foodPositions, pos{x, y})
 			}
 		}
 	}
 
-	if foodPositionsMsg != "" {
-		msg += "|" + foodPositionsMsg[:len(foodPositionsMsg)-1]
-	} else {
-		msg += "|"
-	}
+	msg += "|" + server.foodMsg(foodPositions)
+
+	server.mu.RUnlock()
 
 	bombPositionsMsg := ""
 
 	server.mu.RLock()
 
 	for id, bomb := range server.bombs {
-		bombPositionsMsg += id + "," + strconv.FormatInt(int64(bomb.timeToDetonation), 10) + "," + positionToString(&bomb.bombPosition) + "," + positionsToString(bomb.positions) + "\n"
+		if !bomb.visibleTo(initiatorId) {
+			continue
+		}
+
+		bombPositionsMsg += id + "," + bomb.kind + "," + strconv.FormatInt(int64(bomb.timeToDetonation), 10) + "," + positionToString(&bomb.bombPosition) + "," + positionsToString(bomb.positions) + "\n"
 	}
 
 	server.mu.RUnlock()
@@ -81,54 +146,165 @@ func (server *Server) handleInit(initiator *websocket.Conn, initiatorId string)
 		msg += "|"
 	}
 
+	server.mu.RLock()
+
+	msg += "|" + server.teamsMsg()
+
+	if server.config.WrapEdges {
+		msg += "|1"
+	} else {
+		msg += "|0"
+	}
+
+	msg += "|" + positionsToString(server.walls)
+	msg += "|" + server.itemsMsg()
+	msg += "|"
+
+	if initiatorId != "" {
+		worm := server.worms[initiatorId]
+		msg += strconv.Itoa(worm.foodConsumed) + "/" + strconv.Itoa(worm.foodNeeded)
+	}
+
+	if initiatorId != "" {
+		newWormMsg += "|" + strconv.Itoa(server.worms[initiatorId].team)
+	}
+
+	server.mu.RUnlock()
+
 	initiator.Write([]byte(msg))
-	server.broadcastExcept([]byte(eventNewWorm+"\n"+newWormMsg), initiator)
-}
+	initiator.Write(server.spectatorCountMsg())
+
+	if server.config.Teams > 0 {
+		initiator.Write([]byte(server.scoresMsg()))
+	}
 
-func (server *Server) removePlayer(ws *websocket.Conn) {
 	server.mu.RLock()
 
-	id := server.wormConns[ws]
-	positions := server.worms[id].positions
+	if server.roundInProgress {
+		initiator.Write(server.roundStartMsg())
+	}
+
+	if server.config.BattleRoyale {
+		initiator.Write(server.ringMsg())
+	}
+
+	invulnerableMsg := server.invulnerableMsg()
 
 	server.mu.RUnlock()
 
-	server.mu.Lock()
+	if invulnerableMsg != "" {
+		initiator.Write([]byte(invulnerableMsg))
+	}
+
+	if initiatorId != "" {
+		server.broadcastExcept([]byte(eventNewWorm+"\n"+newWormMsg), initiator)
+
+		if invulnerableMsg != "" {
+			server.broadcastExcept([]byte(invulnerableMsg), initiator)
+		}
+	}
+}
 
-	for _, pos := range positions {
-		server.grid[pos.x][pos.y].worm = ""
+// removeWorm must be called with server.mu held.
+func (server *Server) removeWorm(ws *websocket.Conn, id string) {
+	for _, pos := range server.worms[id].positions {
+		server.vacate(id, pos)
 	}
 
 	delete(server.worms, id)
 	delete(server.wormConns, ws)
+}
+
+func (server *Server) removePlayer(ws *websocket.Conn) {
+	server.mu.Lock()
+
+	server.removeConn(ws)
+	server.pruneMutes()
+
+	if server.removeFromQueue(ws) {
+		server.mu.Unlock()
+		server.sendQueuePositions()
+
+		return
+	}
+
+	if server.spectators[ws] {
+		delete(server.spectators, ws)
+		delete(server.waitingForRound, ws)
+		server.mu.Unlock()
+
+		server.broadcast(server.spectatorCountMsg())
+
+		return
+	}
+
+	id := server.wormConns[ws]
+	server.removeWorm(ws, id)
 
 	server.mu.Unlock()
 
 	server.broadcast([]byte(eventDisconnect + "\n" + id))
+
+	server.promoteQueued()
+}
+
+// keepAlive pings ws until done is closed so dead connections hit their read
+// deadline.
+func keepAlive(ws *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ws.Write([]byte(eventPing))
+		}
+	}
 }
 
 func (server *Server) readFromConnection(ws *websocket.Conn) {
-	server.mu.RLock()
-	id := server.wormConns[ws]
-	server.mu.RUnlock()
+	ws.MaxPayloadBytes = server.config.MaxMessageSize
+
+	if ws.MaxPayloadBytes <= 0 {
+		ws.MaxPayloadBytes = defaultMaxMessageSize
+	}
 
-	buffer := make([]byte, 1024)
+	limiter := newRateLimiter(clientMessageRate, clientMessageBurst)
+	chatLimiter := newRateLimiter(chatRate, chatBurst)
+	violations := newRateLimiter(1/clientViolationForgiveness.Seconds(), maxClientViolations)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go keepAlive(ws, done)
 
 	for {
-		length, error := ws.Read(buffer)
+		ws.SetReadDeadline(time.Now().Add(readTimeout))
 
-		if error != nil {
-			if error == io.EOF {
-				server.removePlayer(ws)
-				break
+		var msg string
+		error := websocket.Message.Receive(ws, &msg)
+
+		if error != nil && !errors.Is(error, websocket.ErrFrameTooLarge) {
+			if error != io.EOF {
+				log.Println("Read error: ", error)
 			}
 
-			log.Println("Read error: ", error)
-			continue
+			ws.Close()
+			server.removePlayer(ws)
+
+			break
 		}
 
-		msg := string(buffer[:length])
-		log.Println("msg from client: ", msg)
+		errorCode := ""
+
+		if !limiter.allow() {
+			errorCode = errorRateLimit
+		} else if error != nil {
+			errorCode = errorMessageSize
+		}
 
 		eventDataSplitIndex := strings.Index(msg, "\n")
 
@@ -144,6 +320,43 @@ func (server *Server) readFromConnection(ws *websocket.Conn) {
 			event = msg
 		}
 
+		if errorCode == "" {
+			errorCode = validateEvent(event, data, eventDataSplitIndex != -1)
+		}
+
+		if errorCode == "" && event == eventChat && !chatLimiter.allow() {
+			errorCode = errorRateLimit
+		}
+
+		if errorCode != "" {
+			if !violations.allow() {
+				log.Println("Disconnecting abusive client: ", remoteIP(ws.Request()))
+
+				ws.Close()
+				server.removePlayer(ws)
+
+				break
+			}
+
+			ws.Write([]byte(eventError + "\n" + errorCode))
+
+			continue
+		}
+
+		server.mu.RLock()
+		id, isPlayer := server.wormConns[ws]
+		spectating := server.spectators[ws]
+		server.mu.RUnlock()
+
+		if spectating && event == eventInit {
+			server.handleInit(ws, "")
+		}
+
+		//queued connections are sent INIT once they are given a worm
+		if !isPlayer {
+			continue
+		}
+
 		switch event {
 		case eventInit:
 			{
@@ -153,19 +366,66 @@ func (server *Server) readFromConnection(ws *websocket.Conn) {
 			{
 				server.handleChangeDir(id, data)
 			}
+		case eventChat:
+			{
+				server.handleChat(ws, id, data)
+			}
+		case eventDropBomb:
+			{
+				server.handleDropBomb(id, data)
+			}
+		case eventBoost:
+			{
+				server.handleBoost(id)
+			}
 		}
 	}
 }
 
 func (server *Server) handle(ws *websocket.Conn) {
-	log.Println("Incoming connection: ", ws.RemoteAddr())
+	ip := remoteIP(ws.Request())
+
+	log.Println("Incoming connection: ", ip)
 
 	server.mu.Lock()
 
-	id := server.newWorm()
-	server.wormConns[ws] = id
+	if !server.addConn(ws, ip) {
+		server.mu.Unlock()
+		ws.Close()
 
-	server.mu.Unlock()
+		return
+	}
+
+	if isSpectator(ws) || server.battleRoyaleInProgress() {
+		server.spectators[ws] = true
+
+		//no one can join a battle royale mid round, they play from the next one
+		if !isSpectator(ws) {
+			server.waitingForRound[ws] = true
+		}
+
+		server.mu.Unlock()
+
+		server.broadcastExcept(server.spectatorCountMsg(), ws)
+	} else if _, added := server.addPlayer(ws); added {
+		server.mu.Unlock()
+	} else if !server.config.QueueWhenFull {
+		server.removeConn(ws)
+		server.mu.Unlock()
+
+		ws.Write([]byte(eventFull))
+		ws.Close()
+
+		return
+	} else {
+		//there is no room for another worm until someone leaves
+		server.queue = append(server.queue, ws)
+		queuePosition := len(server.queue)
+
+		server.mu.Unlock()
+
+		ws.Write([]byte(eventFull + "\n" + strconv.Itoa(queuePosition)))
+	}
 
 	server.readFromConnection(ws)
 }
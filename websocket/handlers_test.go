@@ -0,0 +1,32 @@
+package websocket
+
+import "testing"
+
+func TestHandlersIgnoreRemovedWorms(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{BoostCost: 1})
+	ws := dialTestConn(t, "name=idle")
+
+	//the worm was removed after its event was read, its connection still open
+	tests := []struct {
+		name   string
+		handle func()
+	}{
+		{"change direction", func() { server.handleChangeDir("1", "U") }},
+		{"chat", func() { server.handleChat(ws, "1", "hello") }},
+		{"boost", func() { server.handleBoost("1") }},
+		{"drop bomb", func() { server.handleDropBomb("1", bombSquare) }},
+		{"init", func() { server.handleInit(ws, "1") }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					t.Fatalf("panicked: %v", recovered)
+				}
+			}()
+
+			test.handle()
+		})
+	}
+}
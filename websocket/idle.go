@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const idleCheckInterval = 1 * time.Second
+
+// botDirection picks a direction that keeps worm in bounds and off other worms,
+// preferring to carry on straight. It must be called with server.mu held.
+func (server *Server) botDirection(worm *worm) string {
+	headPos := worm.positions[0]
+	safe := []string{}
+
+	for dir, opposite := range oppositeDirections {
+		if opposite == worm.direction && len(worm.positions) > 1 {
+			continue
+		}
+
+		next, inBounds := server.step(headPos, dir)
+
+		if !inBounds || server.grid[next.x][next.y].wall {
+			continue
+		}
+
+		if server.grid[next.x][next.y].worm != "" {
+			continue
+		}
+
+		if dir == worm.direction {
+			return dir
+		}
+
+		safe = append(safe, dir)
+	}
+
+	if len(safe) == 0 {
+		return worm.direction
+	}
+
+	return safe[rand.Intn(len(safe))]
+}
+
+// startIdleCheck warns players who have stopped sending input and then takes
+// the configured IdleAction against them.
+func (server *Server) startIdleCheck() {
+	ticker := time.NewTicker(idleCheckInterval)
+
+	defer ticker.Stop()
+
+	for range ticker.C {
+		warn := map[*websocket.Conn]time.Duration{}
+		act := []*websocket.Conn{}
+
+		server.mu.Lock()
+
+		for ws, id := range server.wormConns {
+			worm := server.worms[id]
+			idleFor := time.Since(worm.lastInput)
+
+			if idleFor >= server.config.IdleActionAfter {
+				if !worm.idleActionTaken {
+					worm.idleActionTaken = true
+					act = append(act, ws)
+				}
+			} else if server.config.IdleWarnAfter > 0 && idleFor >= server.config.IdleWarnAfter && !worm.idleWarned {
+				worm.idleWarned = true
+				warn[ws] = server.config.IdleActionAfter - idleFor
+			}
+		}
+
+		server.mu.Unlock()
+
+		for ws, remaining := range warn {
+			ws.Write([]byte(eventIdle + "\n" + strconv.Itoa(int(remaining.Seconds())+1)))
+		}
+
+		for _, ws := range act {
+			ws.Write([]byte(eventIdle + "\n0"))
+
+			switch server.config.IdleAction {
+			case IdleActionBot:
+				//the worm is steered by moveWorms until the player changes direction
+			case IdleActionSpectate:
+				server.makeSpectator(ws)
+			default:
+				log.Println("Kicking idle player: ", remoteIP(ws.Request()))
+				ws.Close()
+			}
+		}
+	}
+}
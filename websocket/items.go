@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// Kinds of item worms can pick up, each giving them an effect for a while.
+const (
+	// itemSpeed moves the worm twice every move.
+	itemSpeed = "SPEED"
+	// itemShield absorbs the next collision or damage the worm takes.
+	itemShield = "SHIELD"
+	// itemGhost lets the worm pass through other worms, and them through it.
+	itemGhost = "GHOST"
+	// itemMagnet pulls in food near the worm's head.
+	itemMagnet = "MAGNET"
+)
+
+const (
+	maxItems     = 4
+	magnetRadius = 3
+)
+
+type itemKind struct {
+	duration    time.Duration
+	spawnChance float64
+}
+
+// itemKinds holds how long each effect lasts and the chance of its item
+// spawning every ItemInterval.
+var itemKinds = map[string]itemKind{
+	itemSpeed:  {5 * time.Second, 0.3},
+	itemShield: {15 * time.Second, 0.2},
+	itemGhost:  {4 * time.Second, 0.15},
+	itemMagnet: {8 * time.Second, 0.25},
+}
+
+type item struct {
+	kind     string
+	position pos
+}
+
+// hasEffect must be called with server.mu held.
+func (worm *worm) hasEffect(kind string) bool {
+	return time.Now().Before(worm.effects[kind])
+}
+
+// newItem places an item of kind on a free cell, returning nil if none was
+// found. It must be called with server.mu held.
+func (server *Server) newItem(kind string) (string, *item) {
+	for i := 0; i < 5; i++ {
+		x := rand.Intn(server.gridWidth)
+		y := rand.Intn(server.gridHeight)
+
+		cell := &server.grid[x][y]
+
+		if cell.food || cell.wall || cell.worm != "" || cell.item != "" {
+			continue
+		}
+
+		server.itemIdCounter++
+		id := strconv.FormatUint(server.itemIdCounter, 10)
+
+		item := &item{kind, pos{x, y}}
+		server.items[id] = item
+		cell.item = id
+
+		return id, item
+	}
+
+	return "", nil
+}
+
+func itemMsg(id string, item *item) string {
+	return id + "," + item.kind + "," + positionToString(&item.position)
+}
+
+// itemsMsg must be called with server.mu held.
+func (server *Server) itemsMsg() string {
+	msg := ""
+
+	for id, item := range server.items {
+		if msg != "" {
+			msg += "\n"
+		}
+
+		msg += itemMsg(id, item)
+	}
+
+	return msg
+}
+
+func (server *Server) startItemSpawn() {
+	ticker := time.NewTicker(server.config.ItemInterval)
+
+	defer ticker.Stop()
+
+	for range ticker.C {
+		msg := ""
+
+		server.mu.Lock()
+
+		if server.isPlaying() {
+			for kind, itemKind := range itemKinds {
+				if len(server.items) >= maxItems {
+					break
+				}
+
+				if rand.Float64() >= itemKind.spawnChance {
+					continue
+				}
+
+				if id, item := server.newItem(kind); item != nil {
+					msg += "\n" + itemMsg(id, item)
+				}
+			}
+		}
+
+		server.mu.Unlock()
+
+		if msg != "" {
+			server.broadcast([]byte(eventSpawnItem + msg))
+		}
+	}
+}
+
+// consumeItem gives the worm id the effect of the item at position, if it is
+// still there.
+func (server *Server) consumeItem(id string, position pos) {
+	server.mu.Lock()
+
+	//the board may have been reset since the worm moved
+	cell := &server.grid[position.x][position.y]
+	itemId := cell.item
+	item, ok := server.items[itemId]
+	worm, wormOk := server.worms[id]
+
+	if !ok || !wormOk {
+		server.mu.Unlock()
+		return
+	}
+
+	cell.item = ""
+	delete(server.items, itemId)
+
+	duration := itemKinds[item.kind].duration
+	worm.effects[item.kind] = time.Now().Add(duration)
+
+	server.mu.Unlock()
+
+	server.broadcast([]byte(eventConsumeItem + "\n" + itemId + "|" + id + "|" + item.kind + "|" + strconv.FormatInt(duration.Milliseconds(), 10)))
+}
+
+// useShield spends worm's shield, if it has one, reporting whether it did. It
+// must only be called when the worm would otherwise lose length. The effect is
+// ended on the next move.
+func (server *Server) useShield(worm *worm) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if !worm.hasEffect(itemShield) {
+		return false
+	}
+
+	worm.effects[itemShield] = time.Now()
+
+	return true
+}
+
+// attractFood eats the food within magnetRadius of the worm id's head.
+func (server *Server) attractFood(id string, headPos pos) {
+	var foodPositions []pos
+
+	server.mu.RLock()
+
+	for dx := -magnetRadius; dx <= magnetRadius; dx++ {
+		for dy := -magnetRadius; dy <= magnetRadius; dy++ {
+			if abs(dx)+abs(dy) > magnetRadius {
+				continue
+			}
+
+			position := pos{headPos.x + dx, headPos.y + dy}
+
+			if server.config.WrapEdges {
+				position = server.wrap(position)
+			} else if position.x < 0 || position.x >= server.gridWidth || position.y < 0 || position.y >= server.gridHeight {
+				continue
+			}
+
+			if server.grid[position.x][position.y].food {
+				foodPositions = append(foodPositions, position)
+			}
+		}
+	}
+
+	server.mu.RUnlock()
+
+	for _, position := range foodPositions {
+		server.consumeFood(id, &server.grid[position.x][position.y], &position)
+	}
+}
+
+// endEffects removes the effects that have run out and tells clients.
+func (server *Server) endEffects() {
+	msg := ""
+
+	server.mu.Lock()
+
+	for id, worm := range server.worms {
+		for kind := range worm.effects {
+			if !worm.hasEffect(kind) {
+				delete(worm.effects, kind)
+				msg += "\n" + id + "," + kind
+			}
+		}
+	}
+
+	server.mu.Unlock()
+
+	if msg != "" {
+		server.broadcast([]byte(eventEffectEnd + msg))
+	}
+}
@@ -0,0 +1,59 @@
+package websocket
+
+import "strconv"
+
+// spawnLength is how long worms are when they spawn.
+const spawnLength = 3
+
+// LevelCurve returns how much food a worm of length, its level, must eat to
+// grow to the next.
+type LevelCurve func(length int) int
+
+// LinearCurve needs length times multiplier food for each level.
+func LinearCurve(multiplier int) LevelCurve {
+	return func(length int) int {
+		return length * multiplier
+	}
+}
+
+// QuadraticCurve needs length squared times multiplier food for each level.
+func QuadraticCurve(multiplier int) LevelCurve {
+	return func(length int) int {
+		return length * length * multiplier
+	}
+}
+
+// TableCurve looks up the food needed at each length in table, starting from
+// length 1. Worms longer than the table need its last entry.
+func TableCurve(table []int) LevelCurve {
+	return func(length int) int {
+		if len(table) == 0 {
+			return length
+		}
+
+		return table[min(max(length, 1), len(table))-1]
+	}
+}
+
+// foodNeeded returns how much food a worm of length must eat to grow, using
+// LevelCurve or length times levelMultiplier if there is none.
+func (server *Server) foodNeeded(length int) int {
+	curve := server.config.LevelCurve
+
+	if curve == nil {
+		curve = LinearCurve(server.levelMultiplier)
+	}
+
+	return max(curve(length), 1)
+}
+
+// levelUpMsg must be called with server.mu held.
+func levelUpMsg(id string, worm *worm) []byte {
+	return []byte(eventLevelUp + "\n" + id + "|" + strconv.Itoa(len(worm.positions)) + "|" + strconv.Itoa(worm.foodNeeded))
+}
+
+// progressMsg tells a player how far their worm is towards its next level
+// after losing length. It must be called with server.mu held.
+func progressMsg(worm *worm) []byte {
+	return []byte(eventCollide + "\n" + strconv.Itoa(worm.foodConsumed) + "/" + strconv.Itoa(worm.foodNeeded))
+}
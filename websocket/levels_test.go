@@ -0,0 +1,50 @@
+package websocket
+
+import "testing"
+
+func TestLevelCurves(t *testing.T) {
+	tests := []struct {
+		name       string
+		curve      LevelCurve
+		length     int
+		foodNeeded int
+	}{
+		{"linear", LinearCurve(2), 3, 6},
+		{"quadratic", QuadraticCurve(2), 3, 18},
+		{"table start", TableCurve([]int{1, 5, 9}), 1, 1},
+		{"table middle", TableCurve([]int{1, 5, 9}), 2, 5},
+		{"table past the end", TableCurve([]int{1, 5, 9}), 20, 9},
+		{"table below the start", TableCurve([]int{1, 5, 9}), 0, 1},
+		{"empty table", TableCurve(nil), 4, 4},
+	}
+
+	for _, test := range tests {
+		if foodNeeded := test.curve(test.length); foodNeeded != test.foodNeeded {
+			t.Errorf("%s: length %d needs %d, expected %d", test.name, test.length, foodNeeded, test.foodNeeded)
+		}
+	}
+}
+
+func TestFoodNeeded(t *testing.T) {
+	tests := []struct {
+		name       string
+		multiplier int
+		curve      LevelCurve
+		length     int
+		foodNeeded int
+	}{
+		{"default multiplier", 2, nil, 5, 10},
+		{"curve overrides multiplier", 2, QuadraticCurve(1), 5, 25},
+		{"at least one", 0, nil, 5, 1},
+		{"zero from curve", 1, LinearCurve(0), 5, 1},
+	}
+
+	for _, test := range tests {
+		server := newTestServer(t, 20, 20, Config{LevelCurve: test.curve})
+		server.levelMultiplier = test.multiplier
+
+		if foodNeeded := server.foodNeeded(test.length); foodNeeded != test.foodNeeded {
+			t.Errorf("%s: got %d, expected %d", test.name, foodNeeded, test.foodNeeded)
+		}
+	}
+}
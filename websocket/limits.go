@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/websocket"
+)
+
+var (
+	errOriginNotAllowed = errors.New("origin not allowed")
+	errTooManyConns     = errors.New("too many connections from address")
+)
+
+func remoteIP(r *http.Request) string {
+	host, _, error := net.SplitHostPort(r.RemoteAddr)
+
+	if error != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func (server *Server) originAllowed(origin string) bool {
+	if len(server.config.AllowedOrigins) == 0 {
+		return true
+	}
+
+	for _, allowed := range server.config.AllowedOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handshake rejects connections from unknown origins or from addresses
+// already at their connection cap before the websocket is established.
+func (server *Server) handshake(config *websocket.Config, r *http.Request) error {
+	origin, error := websocket.Origin(config, r)
+
+	if error != nil {
+		return error
+	}
+
+	config.Origin = origin
+
+	originStr := ""
+
+	if origin != nil {
+		originStr = origin.Scheme + "://" + origin.Host
+	}
+
+	if !server.originAllowed(originStr) {
+		return errOriginNotAllowed
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	if !server.ipHasCapacity(remoteIP(r)) {
+		return errTooManyConns
+	}
+
+	return nil
+}
+
+// ipHasCapacity must be called with server.mu held.
+func (server *Server) ipHasCapacity(ip string) bool {
+	return server.config.MaxConnsPerIP <= 0 || server.ipConnCounts[ip] < server.config.MaxConnsPerIP
+}
+
+// isFull must be called with server.mu held.
+func (server *Server) isFull() bool {
+	return server.config.MaxPlayers > 0 && len(server.worms) >= server.config.MaxPlayers
+}
+
+// addPlayer gives ws a new worm, returning false if the game is full or there
+// is no free space on the grid for one. It must be called with server.mu held.
+func (server *Server) addPlayer(ws *websocket.Conn) (string, bool) {
+	if server.isFull() {
+		return "", false
+	}
+
+	id, error := server.newWorm(playerName(ws))
+
+	if error != nil {
+		log.Println(error)
+		return "", false
+	}
+
+	server.wormConns[ws] = id
+
+	return id, true
+}
+
+// addConn registers the address of ws, returning false if it is over its cap.
+// It must be called with server.mu held.
+func (server *Server) addConn(ws *websocket.Conn, ip string) bool {
+	if !server.ipHasCapacity(ip) {
+		return false
+	}
+
+	server.connIPs[ws] = ip
+	server.ipConnCounts[ip]++
+
+	return true
+}
+
+// removeConn must be called with server.mu held.
+func (server *Server) removeConn(ws *websocket.Conn) {
+	ip, ok := server.connIPs[ws]
+
+	if !ok {
+		return
+	}
+
+	delete(server.connIPs, ws)
+	server.ipConnCounts[ip]--
+
+	if server.ipConnCounts[ip] <= 0 {
+		delete(server.ipConnCounts, ip)
+	}
+}
+
+// removeFromQueue must be called with server.mu held.
+func (server *Server) removeFromQueue(ws *websocket.Conn) bool {
+	for i, queued := range server.queue {
+		if queued == ws {
+			server.queue = append(server.queue[:i], server.queue[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (server *Server) sendQueuePositions() {
+	server.mu.RLock()
+
+	for i, queued := range server.queue {
+		queued.Write([]byte(eventFull + "\n" + strconv.Itoa(i+1)))
+	}
+
+	server.mu.RUnlock()
+}
+
+// promoteQueued gives the longest waiting connections a worm while there are
+// free slots.
+func (server *Server) promoteQueued() {
+	promoted := false
+
+	for {
+		server.mu.Lock()
+
+		if len(server.queue) == 0 || server.battleRoyaleInProgress() {
+			server.mu.Unlock()
+			break
+		}
+
+		ws := server.queue[0]
+		id, added := server.addPlayer(ws)
+
+		if !added {
+			server.mu.Unlock()
+			break
+		}
+
+		server.queue = server.queue[1:]
+
+		server.mu.Unlock()
+
+		server.handleInit(ws, id)
+		promoted = true
+	}
+
+	if promoted {
+		server.sendQueuePositions()
+	}
+}
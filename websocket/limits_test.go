@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{"any when unset", nil, "https://elsewhere.example", true},
+		{"listed", []string{"https://wormo.example", "http://localhost:8000"}, "http://localhost:8000", true},
+		{"unlisted", []string{"https://wormo.example"}, "https://elsewhere.example", false},
+		{"different scheme", []string{"https://wormo.example"}, "http://wormo.example", false},
+		{"missing", []string{"https://wormo.example"}, "", false},
+	}
+
+	for _, test := range tests {
+		server := newTestServer(t, 20, 20, Config{AllowedOrigins: test.allowed})
+
+		if ok := server.originAllowed(test.origin); ok != test.ok {
+			t.Errorf("%s: allowed %v, expected %v", test.name, ok, test.ok)
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		origin    string
+		openConns int
+		ok        bool
+	}{
+		{"allowed origin", Config{AllowedOrigins: []string{"http://wormo.example"}}, "http://wormo.example", 0, true},
+		{"other origin", Config{AllowedOrigins: []string{"http://wormo.example"}}, "http://elsewhere.example", 0, false},
+		{"under the address cap", Config{MaxConnsPerIP: 2}, "http://wormo.example", 1, true},
+		{"at the address cap", Config{MaxConnsPerIP: 2}, "http://wormo.example", 2, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, test.config)
+			server.ipConnCounts["127.0.0.1"] = test.openConns
+
+			httpServer := httptest.NewServer(websocket.Server{
+				Handshake: server.handshake,
+				Handler:   func(ws *websocket.Conn) {},
+			})
+
+			defer httpServer.Close()
+
+			client, error := websocket.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), "", test.origin)
+
+			if error == nil {
+				client.Close()
+			}
+
+			if ok := error == nil; ok != test.ok {
+				t.Fatalf("connected %v, expected %v: %v", ok, test.ok, error)
+			}
+		})
+	}
+}
+
+func TestConnCounts(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{MaxConnsPerIP: 2})
+	conns := []*websocket.Conn{dialTestConn(t, ""), dialTestConn(t, ""), dialTestConn(t, "")}
+
+	for i, ws := range conns {
+		if added := server.addConn(ws, "10.0.0.1"); added != (i < 2) {
+			t.Fatalf("connection %d added %v", i+1, added)
+		}
+	}
+
+	if !server.addConn(conns[2], "10.0.0.2") {
+		t.Fatal("another address should have its own cap")
+	}
+
+	server.removeConn(conns[0])
+
+	if server.ipConnCounts["10.0.0.1"] != 1 || !server.ipHasCapacity("10.0.0.1") {
+		t.Fatal("closing a connection should free a slot for its address")
+	}
+
+	server.removeConn(conns[1])
+	server.removeConn(conns[2])
+
+	if len(server.ipConnCounts) != 0 || len(server.connIPs) != 0 {
+		t.Fatal("addresses with no connections should be forgotten")
+	}
+}
+
+func TestIsFull(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPlayers int
+		players    int
+		full       bool
+	}{
+		{"no limit", 0, 50, false},
+		{"under the limit", 2, 1, false},
+		{"at the limit", 2, 2, true},
+	}
+
+	for _, test := range tests {
+		server := newTestServer(t, 20, 20, Config{MaxPlayers: test.maxPlayers})
+
+		for i := 0; i < test.players; i++ {
+			server.worms[string(rune('a'+i))] = &worm{}
+		}
+
+		if full := server.isFull(); full != test.full {
+			t.Errorf("%s: full %v, expected %v", test.name, full, test.full)
+		}
+	}
+}
+
+func TestPromoteQueued(t *testing.T) {
+	server := newTestServer(t, 30, 30, Config{MaxPlayers: 3, QueueWhenFull: true})
+
+	if _, added := server.addPlayer(dialTestConn(t, "name=playing")); !added {
+		t.Fatal("the first player was not added")
+	}
+
+	queued := []*websocket.Conn{dialTestConn(t, "name=first"), dialTestConn(t, "name=second"), dialTestConn(t, "name=third")}
+	server.queue = append(server.queue, queued...)
+
+	server.promoteQueued()
+
+	for i, ws := range queued {
+		if _, playing := server.wormConns[ws]; playing != (i < 2) {
+			t.Fatalf("queued connection %d playing %v", i+1, playing)
+		}
+	}
+
+	if len(server.queue) != 1 || server.queue[0] != queued[2] {
+		t.Fatal("the last to queue should still be waiting")
+	}
+}
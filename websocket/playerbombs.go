@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBombCooldown             = 5 * time.Second
+	maxHeldBombs                    = 3
+	playerBombRadius                = 2
+	playerBombDetonationTimeSeconds = 3
+)
+
+// bombCooldown returns how long a worm must wait between dropping bombs.
+func (server *Server) bombCooldown() time.Duration {
+	if server.config.BombCooldown > 0 {
+		return server.config.BombCooldown
+	}
+
+	return defaultBombCooldown
+}
+
+// bombsMsg tells a player how many bombs they hold and the milliseconds left
+// until they can drop the next. It must be called with server.mu held.
+func (server *Server) bombsMsg(worm *worm) []byte {
+	cooldown := max(time.Until(worm.lastBombDropped.Add(server.bombCooldown())), 0)
+
+	return []byte(eventBombs + "\n" + strconv.Itoa(worm.heldBombs) + "|" + strconv.FormatInt(cooldown.Milliseconds(), 10))
+}
+
+// earnBomb counts food eaten by worm towards its next bomb, returning true
+// once it has earned one. It must be called with server.mu held.
+func (server *Server) earnBomb(worm *worm) bool {
+	if server.config.FoodPerBomb <= 0 || worm.heldBombs >= maxHeldBombs {
+		return false
+	}
+
+	worm.foodTowardsBomb++
+
+	if worm.foodTowardsBomb < server.config.FoodPerBomb {
+		return false
+	}
+
+	worm.foodTowardsBomb = 0
+	worm.heldBombs++
+
+	return true
+}
+
+// handleDropBomb drops one of the worm id's bombs behind its tail as a bomb of
+// kind, a square one if empty, unless it has none or is still cooling down from
+// the last.
+func (server *Server) handleDropBomb(id string, kind string) {
+	if kind == "" {
+		kind = bombSquare
+	}
+
+	server.mu.Lock()
+
+	worm, ok := server.worms[id]
+
+	if !ok {
+		server.mu.Unlock()
+		return
+	}
+
+	if worm.heldBombs <= 0 || time.Since(worm.lastBombDropped) < server.bombCooldown() {
+		msg := server.bombsMsg(worm)
+		server.mu.Unlock()
+
+		server.sendTo(id, msg)
+
+		return
+	}
+
+	worm.heldBombs--
+	worm.lastBombDropped = time.Now()
+
+	tailPos := worm.positions[len(worm.positions)-1]
+	msg := server.bombsMsg(worm)
+
+	server.mu.Unlock()
+
+	server.sendTo(id, msg)
+
+	go server.placeBomb(tailPos.x, tailPos.y, kind, playerBombRadius, bombDetonationTimeSeconds(kind, playerBombDetonationTimeSeconds), id)
+}
+
+// creditKills adds the worms owner's bomb reduced to nothing to its kills.
+func (server *Server) creditKills(owner string, killed []string) {
+	if len(killed) == 0 {
+		return
+	}
+
+	server.mu.Lock()
+
+	worm, ok := server.worms[owner]
+
+	if !ok {
+		server.mu.Unlock()
+		return
+	}
+
+	msg := ""
+
+	for _, id := range killed {
+		victim, ok := server.worms[id]
+
+		if !ok {
+			continue
+		}
+
+		worm.kills++
+		msg += "\n" + owner + "|" + worm.displayName(owner) + "|" + id + "|" + victim.displayName(id) + "|" + strconv.Itoa(worm.kills)
+	}
+
+	server.mu.Unlock()
+
+	if msg != "" {
+		server.broadcast([]byte(eventKill + msg))
+	}
+}
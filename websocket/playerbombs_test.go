@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEarnBomb(t *testing.T) {
+	tests := []struct {
+		name            string
+		foodPerBomb     int
+		heldBombs       int
+		foodTowardsBomb int
+		earned          bool
+		wantHeld        int
+		wantTowards     int
+	}{
+		{"disabled", 0, 0, 0, false, 0, 0},
+		{"counts food", 3, 0, 1, false, 0, 2},
+		{"earns a bomb", 3, 1, 2, true, 2, 0},
+		{"holding the most", 3, maxHeldBombs, 2, false, maxHeldBombs, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{FoodPerBomb: test.foodPerBomb})
+			worm := &worm{heldBombs: test.heldBombs, foodTowardsBomb: test.foodTowardsBomb}
+
+			if earned := server.earnBomb(worm); earned != test.earned {
+				t.Fatalf("earned %v, expected %v", earned, test.earned)
+			}
+
+			if worm.heldBombs != test.wantHeld || worm.foodTowardsBomb != test.wantTowards {
+				t.Fatalf("holding %d with %d food towards the next, expected %d and %d", worm.heldBombs, worm.foodTowardsBomb, test.wantHeld, test.wantTowards)
+			}
+		})
+	}
+}
+
+func TestDropBombCooldown(t *testing.T) {
+	tests := []struct {
+		name        string
+		heldBombs   int
+		lastDropped time.Duration
+		dropped     bool
+	}{
+		{"no bombs", 0, time.Hour, false},
+		{"cooling down", 1, time.Second, false},
+		{"ready", 1, time.Minute, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{FoodPerBomb: 1, BombCooldown: 10 * time.Second})
+			worm := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+			worm.heldBombs = test.heldBombs
+			worm.lastBombDropped = time.Now().Add(-test.lastDropped)
+
+			server.handleDropBomb("1", "")
+
+			server.mu.Lock()
+			dropped := worm.heldBombs < test.heldBombs
+			server.mu.Unlock()
+
+			if dropped != test.dropped {
+				t.Fatalf("dropped %v, expected %v", dropped, test.dropped)
+			}
+
+			if !dropped {
+				return
+			}
+
+			//wait for the bomb to be placed behind the tail, then clear it away
+			for {
+				server.mu.Lock()
+				bombs := len(server.bombs)
+
+				if bombs > 0 {
+					for _, bomb := range server.bombs {
+						if bomb.bombPosition != (pos{3, 5}) || bomb.owner != "1" {
+							t.Errorf("bomb dropped at %v by %q, expected behind the tail by its worm", bomb.bombPosition, bomb.owner)
+						}
+					}
+
+					server.defuseBombs()
+				}
+
+				server.mu.Unlock()
+
+				if bombs > 0 {
+					break
+				}
+
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestPlayerBombSparesOwner(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{})
+	owner := addTestWorm(server, "1", 0, "R", pos{12, 10}, pos{11, 10}, pos{10, 10})
+	victim := addTestWorm(server, "2", 0, "D", pos{9, 11}, pos{9, 10})
+
+	server.placeBomb(10, 10, bombSquare, 1, 0, "1")
+
+	if len(owner.positions) != 3 {
+		t.Fatalf("the owner was hurt by their own bomb, its length is %d", len(owner.positions))
+	}
+
+	if len(victim.positions) != 1 {
+		t.Fatalf("the victim is %d long, expected it reduced to 1", len(victim.positions))
+	}
+
+	if owner.kills != 1 {
+		t.Fatalf("the owner has %d kills, expected 1", owner.kills)
+	}
+}
@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+type replayEntry struct {
+	//milliseconds since the server started
+	Ms    int64  `json:"ms"`
+	Event string `json:"event"`
+	//chat from a muted player, which was never broadcast
+	Muted bool `json:"muted,omitempty"`
+}
+
+// record appends msg to the Replay, if there is one.
+func (server *Server) record(msg []byte, muted bool) {
+	if server.config.Replay == nil {
+		return
+	}
+
+	line, error := json.Marshal(replayEntry{time.Since(server.started).Milliseconds(), string(msg), muted})
+
+	if error != nil {
+		log.Println(error)
+		return
+	}
+
+	server.replayMu.Lock()
+	defer server.replayMu.Unlock()
+
+	if _, error := server.config.Replay.Write(append(line, '\n')); error != nil {
+		log.Println(error)
+	}
+}
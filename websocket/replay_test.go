@@ -0,0 +1,40 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	var replay bytes.Buffer
+
+	server := newTestServer(t, 20, 20, Config{Replay: &replay})
+
+	server.broadcast([]byte(eventChat + "\n1|wormy|hello"))
+	server.record([]byte(eventChat+"\n2|rude|muted words"), true)
+
+	lines := strings.Split(strings.TrimSpace(replay.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 replay lines, got %q", replay.String())
+	}
+
+	want := []replayEntry{
+		{Event: "CHAT\n1|wormy|hello"},
+		{Event: "CHAT\n2|rude|muted words", Muted: true},
+	}
+
+	for i, line := range lines {
+		var entry replayEntry
+
+		if error := json.Unmarshal([]byte(line), &entry); error != nil {
+			t.Fatal(error)
+		}
+
+		if entry.Event != want[i].Event || entry.Muted != want[i].Muted || entry.Ms < 0 {
+			t.Errorf("line %d is %+v, expected %+v", i, entry, want[i])
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package websocket
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+	"wormo/gamemap"
+)
+
+const roundCheckInterval = 250 * time.Millisecond
+
+type standing struct {
+	id     string
+	name   string
+	team   int
+	length int
+}
+
+func (server *Server) roundsEnabled() bool {
+	return server.config.RoundDuration > 0 || server.config.RoundTargetLength > 0 || server.config.BattleRoyale
+}
+
+// isPlaying reports whether worms should move and items spawn, which is when
+// there are players and, with rounds enabled, a round is in progress.
+// It must be called with server.mu held.
+func (server *Server) isPlaying() bool {
+	return len(server.wormConns) > 0 && (!server.roundsEnabled() || server.roundInProgress)
+}
+
+// standings must be called with server.mu held.
+func (server *Server) standings() []standing {
+	standings := []standing{}
+
+	for id, worm := range server.worms {
+		standings = append(standings, standing{id, worm.displayName(id), worm.team, len(worm.positions)})
+	}
+
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].length != standings[j].length {
+			return standings[i].length > standings[j].length
+		}
+
+		return standings[i].id < standings[j].id
+	})
+
+	//the last worms eliminated place highest behind the survivors
+	for i := len(server.eliminated) - 1; i >= 0; i-- {
+		standings = append(standings, server.eliminated[i])
+	}
+
+	return standings
+}
+
+func (server *Server) roundStartMsg() []byte {
+	remaining := 0
+
+	if server.config.RoundDuration > 0 {
+		remaining = int(time.Until(server.roundEnds).Round(time.Second).Seconds())
+	}
+
+	return []byte(eventRoundStart + "\n" + strconv.Itoa(server.roundNumber) + "|" + strconv.Itoa(remaining) + "|" + strconv.Itoa(server.config.RoundTargetLength) + "|" + strconv.Itoa(server.foodNeeded(spawnLength)))
+}
+
+// regenerateMap swaps in a newly generated map for the next round, if the
+// server generates its maps. It must be called with server.mu held.
+func (server *Server) regenerateMap() bool {
+	if server.config.MapGenerator == "" || server.roundNumber == 0 {
+		return false
+	}
+
+	gameMap, error := gamemap.Generate(server.config.MapGenerator, server.gridWidth, server.gridHeight, server.config.MapSeed+int64(server.roundNumber))
+
+	if error != nil {
+		log.Println("Keeping the last map, could not generate a new one: ", error)
+		return false
+	}
+
+	server.gameMap = gameMap
+	server.loadMap()
+
+	return true
+}
+
+// startRound clears the board and respawns every worm.
+func (server *Server) startRound() {
+	server.mu.Lock()
+
+	mapChanged := server.regenerateMap()
+
+	//when food decays is kept on the grid's cells, so is reset along with them
+	server.initGrid()
+	server.items = map[string]*item{}
+	server.defuseBombs()
+
+	//old heads shouldn't keep new worms away from where they used to be
+	for _, worm := range server.worms {
+		worm.positions = nil
+	}
+
+	var unspawnedIds []string
+
+	for ws, id := range server.wormConns {
+		//players there is no room for watch until the next round
+		if server.respawn(id, server.worms[id]) != nil {
+			server.removeWorm(ws, id)
+			server.spectators[ws] = true
+			server.waitingForRound[ws] = true
+
+			unspawnedIds = append(unspawnedIds, id)
+		}
+	}
+
+	rejoined := server.rejoinWaiting()
+
+	server.roundNumber++
+	server.roundInProgress = true
+	server.roundEnds = time.Now().Add(server.config.RoundDuration)
+	server.lastRingShrink = time.Now()
+	server.lastScoresMsg = ""
+
+	msg := server.roundStartMsg()
+	ringMsg := server.ringMsg()
+	mapMsg := eventMap + "\n" + positionsToString(server.walls)
+	invulnerableMsg := server.invulnerableMsg()
+
+	server.mu.Unlock()
+
+	if mapChanged {
+		server.broadcast([]byte(mapMsg))
+	}
+
+	for _, id := range unspawnedIds {
+		server.broadcast([]byte(eventDisconnect + "\n" + id))
+	}
+
+	server.broadcast(msg)
+
+	if server.config.BattleRoyale {
+		server.broadcast(ringMsg)
+	}
+
+	if invulnerableMsg != "" {
+		server.broadcast([]byte(invulnerableMsg))
+	}
+
+	for ws, id := range rejoined {
+		server.handleInit(ws, id)
+	}
+
+	if len(rejoined) > 0 || len(unspawnedIds) > 0 {
+		server.broadcast(server.spectatorCountMsg())
+	}
+
+	server.promoteQueued()
+}
+
+// roundOver reports whether the time is up or a worm has reached the target length.
+func (server *Server) roundOver() bool {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	if server.config.RoundDuration > 0 && !time.Now().Before(server.roundEnds) {
+		return true
+	}
+
+	//a battle royale round started by a lone player carries on until they are eliminated
+	if server.battleRoyaleInProgress() && len(server.eliminated) > 0 && len(server.worms) <= 1 {
+		return true
+	}
+
+	if server.config.RoundTargetLength > 0 {
+		for _, worm := range server.worms {
+			if len(worm.positions) >= server.config.RoundTargetLength {
+				return true
+			}
+		}
+	}
+
+	return len(server.wormConns) == 0
+}
+
+// endRound stops play and announces the longest worm, or the last one standing
+// in battle royale, and in team mode the team with the highest score, as the winners.
+func (server *Server) endRound() {
+	server.mu.Lock()
+
+	server.roundInProgress = false
+	standings := server.standings()
+
+	server.mu.Unlock()
+
+	winnerId := ""
+
+	if len(standings) > 0 {
+		winnerId = standings[0].id
+	}
+
+	winningTeam := 0
+
+	if server.config.Teams > 0 {
+		scores := make([]int, server.config.Teams+1)
+
+		for _, standing := range standings {
+			scores[standing.team] += standing.length
+		}
+
+		for team := 1; team <= server.config.Teams; team++ {
+			if winningTeam == 0 || scores[team] > scores[winningTeam] {
+				winningTeam = team
+			}
+		}
+	}
+
+	standingsMsg := ""
+
+	for _, standing := range standings {
+		if standingsMsg != "" {
+			standingsMsg += "\n"
+		}
+
+		standingsMsg += standing.id + "," + standing.name + "," + strconv.Itoa(standing.team) + "," + strconv.Itoa(standing.length)
+	}
+
+	server.broadcast([]byte(eventRoundEnd + "\n" + winnerId + "|" + strconv.Itoa(winningTeam) + "|" + strconv.Itoa(int(server.config.Intermission.Seconds())) + "|" + standingsMsg))
+}
+
+// hasPlayers reports whether anyone is playing or waiting to rejoin in the
+// next round. It must be called with server.mu held.
+func (server *Server) hasPlayers() bool {
+	return len(server.wormConns) > 0 || len(server.waitingForRound) > 0
+}
+
+// startRounds plays rounds back to back with an intermission between them,
+// waiting for players to join before each round starts.
+func (server *Server) startRounds() {
+	ticker := time.NewTicker(roundCheckInterval)
+
+	defer ticker.Stop()
+
+	for range ticker.C {
+		server.mu.RLock()
+		hasPlayers := server.hasPlayers()
+		server.mu.RUnlock()
+
+		if !hasPlayers {
+			continue
+		}
+
+		server.startRound()
+
+		for range ticker.C {
+			server.tickBattleRoyale()
+
+			if server.roundOver() {
+				break
+			}
+		}
+
+		server.endRound()
+
+		time.Sleep(server.config.Intermission)
+	}
+}
@@ -1,12 +1,13 @@
 package websocket
 
 import (
-	"math"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+	"wormo/gamemap"
 
 	"golang.org/x/net/websocket"
 )
@@ -26,20 +27,52 @@ type bomb struct {
 	bombPosition     pos
 	positions        []pos
 	timeToDetonation int
+	owner            string
+	kind             string
+	placed           time.Time
+	//closed to set the bomb off early
+	trigger   chan struct{}
+	triggered bool
+	//set when the board is reset, the bomb goes away without detonating
+	defused bool
 }
 
 type Server struct {
 	gridWidth       int
 	gridHeight      int
 	levelMultiplier int
+	config          Config
 	wormIdCounter   uint64
 	bombIdCounter   uint64
+	itemIdCounter   uint64
 	worms           map[string]*worm
 	wormConns       map[*websocket.Conn]string
+	spectators      map[*websocket.Conn]bool
+	muted           map[string]time.Time
+	lastScoresMsg   string
+	roundNumber     int
+	roundInProgress bool
+	roundEnds       time.Time
+	ringInset       int
+	lastRingShrink  time.Time
+	lastRingDamage  time.Time
+	eliminated      []standing
+	waitingForRound map[*websocket.Conn]bool
+	gameMap         *gamemap.Map
+	walls           []pos
+	spawnCells      []pos
+	foodRichCells   []pos
+	connIPs         map[*websocket.Conn]string
+	ipConnCounts    map[string]int
+	queue           []*websocket.Conn
 	bombs           map[string]*bomb
+	items           map[string]*item
 	grid            [][]cellInfo
+	started         time.Time
 	Server          *http.Server
 	mu              sync.RWMutex
+	//kept apart from mu as events are recorded while it is read locked
+	replayMu sync.Mutex
 }
 
 type collisionInfo struct {
@@ -48,16 +81,37 @@ type collisionInfo struct {
 }
 
 func (server *Server) broadcast(msg []byte) {
+	server.record(msg, false)
+
 	server.mu.RLock()
 
 	for k := range server.wormConns {
 		k.Write(msg)
 	}
 
+	for k := range server.spectators {
+		k.Write(msg)
+	}
+
+	server.mu.RUnlock()
+}
+
+// sendTo writes msg to the player owning the worm id, if they are connected.
+func (server *Server) sendTo(id string, msg []byte) {
+	server.mu.RLock()
+
+	for k, wormId := range server.wormConns {
+		if wormId == id {
+			k.Write(msg)
+		}
+	}
+
 	server.mu.RUnlock()
 }
 
 func (server *Server) broadcastExcept(msg []byte, except *websocket.Conn) {
+	server.record(msg, false)
+
 	server.mu.RLock()
 
 	for k := range server.wormConns {
@@ -66,55 +120,72 @@ func (server *Server) broadcastExcept(msg []byte, except *websocket.Conn) {
 		}
 	}
 
+	for k := range server.spectators {
+		if k != except {
+			k.Write(msg)
+		}
+	}
+
 	server.mu.RUnlock()
 }
 
 func (server *Server) handleBomb() {
-	server.bombIdCounter++
-	bombId := server.bombIdCounter
-	bombIdStr := strconv.FormatUint(bombId, 10)
-
+	kind := randomBombKind()
 	radius := rand.Intn(maxBombRadius-minBombRadius) + minBombRadius
 
 	x := rand.Intn(server.gridWidth)
 	y := rand.Intn(server.gridHeight)
 
-	lowX := int(math.Max(0, float64(x-radius)))
-	highX := int(math.Min(float64(server.gridWidth-1), float64(x+radius)))
-
-	lowY := int(math.Max(0, float64(y-radius)))
-	highY := int(math.Min(float64(server.gridHeight-1), float64(y+radius)))
+	detonationTimeSeconds := rand.Intn(maxBombDetonationTimeSeconds-minBombDetonationTimeSeconds) + minBombDetonationTimeSeconds
 
-	width := highX - lowX + 1
-	height := highY - lowY + 1
+	server.placeBomb(x, y, kind, radius, bombDetonationTimeSeconds(kind, detonationTimeSeconds), "")
+}
 
-	bombPositions := make([]pos, width*height)
+// placeBomb sets off a bomb of kind at x, y which detonates after
+// detonationTimeSeconds, or sooner if another blast or a worm sets it off.
+// owner is the id of the worm that dropped it, which is spared from the blast
+// and credited with the kills, or empty for bombs spawned by the server.
+func (server *Server) placeBomb(x int, y int, kind string, radius int, detonationTimeSeconds int, owner string) {
+	bombId := atomic.AddUint64(&server.bombIdCounter, 1)
+	bombIdStr := strconv.FormatUint(bombId, 10)
 
-	index := 0
+	bombPositions := server.blastPositions(kind, x, y, radius)
+	detonationTime := time.Duration(detonationTimeSeconds) * time.Second
 
-	for curX := lowX; curX <= highX; curX++ {
-		for curY := lowY; curY <= highY; curY++ {
-			bombPositions[index] = pos{curX, curY}
-			index++
-		}
+	bomb := &bomb{
+		bombPosition:     pos{x, y},
+		positions:        bombPositions,
+		timeToDetonation: detonationTimeSeconds,
+		owner:            owner,
+		kind:             kind,
+		placed:           time.Now(),
+		trigger:          make(chan struct{}),
 	}
 
-	detonationTimeSeconds := rand.Intn(maxBombDetonationTimeSeconds-minBombDetonationTimeSeconds) + minBombDetonationTimeSeconds
-	detonationTime := time.Duration(detonationTimeSeconds) * time.Second
-
 	server.mu.Lock()
-	server.bombs[bombIdStr] = &bomb{pos{x, y}, bombPositions, detonationTimeSeconds}
+	server.bombs[bombIdStr] = bomb
 	server.mu.Unlock()
 
-	server.broadcast([]byte(eventSpawnBomb + "\n" + bombIdStr + "|" + strconv.FormatInt(int64(detonationTimeSeconds), 10) + "|" + positionToString(&pos{x, y}) + "|" + positionsToString(bombPositions)))
+	spawnMsg := []byte(eventSpawnBomb + "\n" + bombIdStr + "|" + strconv.FormatInt(int64(detonationTimeSeconds), 10) + "|" + positionToString(&pos{x, y}) + "|" + positionsToString(bombPositions) + "|" + owner + "|" + kind)
+
+	//mines are only shown to whoever laid them
+	if kind != bombMine {
+		server.broadcast(spawnMsg)
+	} else if owner != "" {
+		server.sendTo(owner, spawnMsg)
+	}
 
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
 
-		bomb := server.bombs[bombIdStr]
+		for {
+			select {
+			case <-ticker.C:
+			case <-bomb.trigger:
+				return
+			}
 
-		for range ticker.C {
 			server.mu.Lock()
 			bomb.timeToDetonation--
 			server.mu.Unlock()
@@ -125,7 +196,21 @@ func (server *Server) handleBomb() {
 		}
 	}()
 
-	time.Sleep(detonationTime)
+	select {
+	case <-time.After(detonationTime):
+	case <-bomb.trigger:
+	}
+
+	server.mu.Lock()
+
+	if bomb.defused {
+		server.mu.Unlock()
+		return
+	}
+
+	server.triggerBomb(bomb)
+	server.chainReaction(bomb)
+	server.mu.Unlock()
 
 	damageMap := map[string]int{}
 
@@ -134,7 +219,7 @@ func (server *Server) handleBomb() {
 	for _, pos := range bombPositions {
 		worm := server.grid[pos.x][pos.y].worm
 
-		if worm != "" {
+		if worm != "" && worm != owner {
 			damageMap[worm]++
 		}
 	}
@@ -142,12 +227,26 @@ func (server *Server) handleBomb() {
 	server.mu.RUnlock()
 
 	wormsMsg := ""
+	var killed []string
 
 	for wormId, damage := range damageMap {
+		server.mu.RLock()
 		worm := server.worms[wormId]
+		server.mu.RUnlock()
+
+		//another blast may have already eliminated and removed it
+		if worm == nil {
+			continue
+		}
+
+		oldLength := len(worm.positions)
 
-		server.reduce(worm, damage)
+		server.reduce(wormId, worm, damage)
 		wormsMsg += wormId + "," + positionsToString(worm.positions) + "\n"
+
+		if worm.eliminated || (oldLength > 1 && len(worm.positions) == 1) {
+			killed = append(killed, wormId)
+		}
 	}
 
 	server.mu.Lock()
@@ -155,10 +254,20 @@ func (server *Server) handleBomb() {
 	server.mu.Unlock()
 
 	if wormsMsg != "" {
-		server.broadcast([]byte(eventDetonateBomb + "\n" + bombIdStr + "|" + wormsMsg[:len(wormsMsg)-1]))
+		server.broadcast([]byte(eventDetonateBomb + "\n" + bombIdStr + "|" + kind + "|" + wormsMsg[:len(wormsMsg)-1]))
 	} else {
-		server.broadcast([]byte(eventDetonateBomb + "\n" + bombIdStr))
+		server.broadcast([]byte(eventDetonateBomb + "\n" + bombIdStr + "|" + kind))
 	}
+
+	if owner != "" {
+		server.creditKills(owner, killed)
+	}
+
+	if kind == bombCluster {
+		server.scatterCluster(pos{x, y}, radius, owner)
+	}
+
+	server.removeEliminated()
 }
 
 func (server *Server) startBombSpawn() {
@@ -170,7 +279,7 @@ func (server *Server) startBombSpawn() {
 		server.mu.RLock()
 		unlocked := false
 
-		if len(server.wormConns) > 0 {
+		if server.isPlaying() {
 			server.mu.RUnlock()
 			unlocked = true
 
@@ -188,11 +297,18 @@ func (server *Server) newFood() *pos {
 		x := rand.Intn(server.gridWidth)
 		y := rand.Intn(server.gridHeight)
 
+		//half of all food lands in the map's food-rich regions, if it has any
+		if len(server.foodRichCells) > 0 && rand.Intn(2) == 0 {
+			foodRichCell := server.foodRichCells[rand.Intn(len(server.foodRichCells))]
+			x = foodRichCell.x
+			y = foodRichCell.y
+		}
+
 		server.mu.RLock()
 
 		food := &server.grid[x][y].food
 
-		if *food {
+		if *food || server.grid[x][y].wall || server.grid[x][y].item != "" {
 			server.mu.RUnlock()
 			continue
 		}
@@ -200,7 +316,7 @@ func (server *Server) newFood() *pos {
 		server.mu.RUnlock()
 
 		server.mu.Lock()
-		*food = true
+		server.placeFood(pos{x, y}, server.randomFoodKind())
 		server.mu.Unlock()
 
 		return &pos{x, y}
@@ -218,32 +334,24 @@ func (server *Server) startFoodSpawn() {
 		server.mu.RLock()
 		unlocked := false
 
-		if len(server.wormConns) > 0 {
+		if server.isPlaying() {
 			server.mu.RUnlock()
 			unlocked = true
 
-			newFoodPos := server.newFood()
-
-			foodStr := ""
+			var foodPositions []pos
 
-			if newFoodPos != nil {
-				foodStr += positionToString(newFoodPos)
-			}
-
-			for i := 0; i < rand.Intn(maxFoodPerInterval); i++ {
-				newFoodPos = server.newFood()
-
-				if newFoodPos != nil {
-					if foodStr != "" {
-						foodStr += ","
-					}
-
-					foodStr += positionToString(newFoodPos)
+			for i := 0; i < rand.Intn(maxFoodPerInterval)+1; i++ {
+				if newFoodPos := server.newFood(); newFoodPos != nil {
+					foodPositions = append(foodPositions, *newFoodPos)
 				}
 			}
 
-			if newFoodPos != nil {
-				server.broadcast([]byte(eventSpawnFood + "\n" + foodStr))
+			if len(foodPositions) > 0 {
+				server.mu.RLock()
+				foodMsg := server.foodMsg(foodPositions)
+				server.mu.RUnlock()
+
+				server.broadcast([]byte(eventSpawnFood + "\n" + foodMsg))
 			}
 		}
 
@@ -254,7 +362,7 @@ func (server *Server) startFoodSpawn() {
 }
 
 func (server *Server) moveWorms() {
-	ticker := time.NewTicker(wormMoveInterval)
+	ticker := time.NewTicker(moveTickInterval)
 
 	defer ticker.Stop()
 
@@ -264,14 +372,16 @@ func (server *Server) moveWorms() {
 		server.mu.RLock()
 		unlocked := false
 
-		if len(server.wormConns) > 0 {
+		if server.isPlaying() {
 			server.mu.RUnlock()
 			unlocked = true
 
-			msg := eventMove + "\n"
+			moved := map[string]bool{}
 
 			for id, worm := range server.worms {
-				server.move(id, worm.direction, &collisions)
+				if server.advance(id, worm, &collisions) {
+					moved[id] = true
+				}
 			}
 
 			wormsMsg := ""
@@ -281,19 +391,26 @@ func (server *Server) moveWorms() {
 
 				if didCollide {
 					if collison.loss {
-						server.reduce(worm, len(worm.positions)/2)
+						server.reduce(id, worm, len(worm.positions)/2)
 					}
 					if collison.gains > 0 {
-						server.extend(worm, collison.gains)
+						server.extend(id, worm, collison.gains)
 					}
 				}
 
-				wormsMsg += id + "," + positionsToString(worm.positions) + "\n"
+				//only worms that moved or changed length are sent
+				if moved[id] || didCollide {
+					wormsMsg += id + "," + positionsToString(worm.positions) + "\n"
+				}
 			}
 
-			msg += wormsMsg[:len(wormsMsg)-1]
+			if wormsMsg != "" {
+				server.broadcast([]byte(eventMove + "\n" + wormsMsg[:len(wormsMsg)-1]))
+			}
 
-			server.broadcast([]byte(msg))
+			server.endEffects()
+			server.removeEliminated()
+			server.broadcastScores()
 		}
 
 		if !unlocked {
@@ -314,40 +431,109 @@ func (server *Server) initGrid() {
 			server.grid[x][y] = cellInfo{
 				"",
 				false,
+				server.gameMap != nil && server.gameMap.IsWall(x, y),
+				"",
+				"",
+				time.Time{},
+			}
+		}
+	}
+}
+
+// loadMap copies the cells worms spawn in and food is drawn to from the map.
+func (server *Server) loadMap() {
+	server.walls = nil
+	server.spawnCells = nil
+	server.foodRichCells = nil
+
+	if server.gameMap == nil {
+		return
+	}
+
+	for x := 0; x < server.gridWidth; x++ {
+		for y := 0; y < server.gridHeight; y++ {
+			switch server.gameMap.Cells[x][y] {
+			case gamemap.Wall:
+				server.walls = append(server.walls, pos{x, y})
+			case gamemap.Spawn:
+				server.spawnCells = append(server.spawnCells, pos{x, y})
+			case gamemap.FoodRich:
+				server.foodRichCells = append(server.foodRichCells, pos{x, y})
 			}
 		}
 	}
 }
 
-func NewServer(port uint16, gridWidth uint8, gridHeight uint8, levelMultiplier uint8) *Server {
+func NewServer(port uint16, gridWidth uint8, gridHeight uint8, levelMultiplier uint8, config Config) *Server {
+	server := newServer(port, gridWidth, gridHeight, levelMultiplier, config)
+
+	go server.startFoodSpawn()
+	go server.startBombSpawn()
+	go server.moveWorms()
+
+	if config.FoodExpiry > 0 {
+		go server.startFoodDecay()
+	}
+
+	if config.ItemInterval > 0 {
+		go server.startItemSpawn()
+	}
+
+	if config.IdleActionAfter > 0 {
+		go server.startIdleCheck()
+	}
+
+	if server.roundsEnabled() {
+		go server.startRounds()
+	}
+
+	return server
+}
+
+// newServer sets up a server with an empty grid without starting any of the
+// game loops.
+func newServer(port uint16, gridWidth uint8, gridHeight uint8, levelMultiplier uint8, config Config) *Server {
 	wsServer := &http.Server{
 		Addr: ":" + strconv.FormatUint(uint64(port), 10),
 	}
 
+	if config.Map != nil {
+		gridWidth = uint8(config.Map.Width)
+		gridHeight = uint8(config.Map.Height)
+	}
+
 	server := &Server{
-		int(gridWidth),
-		int(gridHeight),
-		int(levelMultiplier),
-		0,
-		0,
-		map[string]*worm{},
-		map[*websocket.Conn]string{},
-		map[string]*bomb{},
-		[][]cellInfo{},
-		wsServer,
-		sync.RWMutex{},
+		gridWidth:       int(gridWidth),
+		gridHeight:      int(gridHeight),
+		levelMultiplier: int(levelMultiplier),
+		config:          config,
+		worms:           map[string]*worm{},
+		wormConns:       map[*websocket.Conn]string{},
+		spectators:      map[*websocket.Conn]bool{},
+		muted:           map[string]time.Time{},
+		waitingForRound: map[*websocket.Conn]bool{},
+		gameMap:         config.Map,
+		connIPs:         map[*websocket.Conn]string{},
+		ipConnCounts:    map[string]int{},
+		bombs:           map[string]*bomb{},
+		items:           map[string]*item{},
+		grid:            [][]cellInfo{},
+		started:         time.Now(),
+		Server:          wsServer,
 	}
 
 	wsMux := http.NewServeMux()
-	wsMux.Handle("/", websocket.Handler(server.handle))
+	wsMux.Handle("/", websocket.Server{
+		Handshake: server.handshake,
+		Handler:   server.handle,
+	})
+	wsMux.HandleFunc("POST /admin/mute", server.handleMute)
+	wsMux.HandleFunc("POST /admin/unmute", server.handleUnmute)
 
 	wsServer.Handler = wsMux
 
+	server.loadMap()
 	server.initGrid()
 
-	go server.startFoodSpawn()
-	go server.startBombSpawn()
-	go server.moveWorms()
-
 	return server
 }
@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// newTestServer returns a server with an empty grid and none of the game loops
+// running, so tests can drive it directly.
+func newTestServer(t *testing.T, width int, height int, config Config) *Server {
+	t.Helper()
+
+	return newServer(0, uint8(width), uint8(height), 1, config)
+}
+
+// addTestWorm puts a worm with id on the grid at positions, head first.
+func addTestWorm(server *Server, id string, team int, dir string, positions ...pos) *worm {
+	worm := &worm{
+		team:       team,
+		direction:  dir,
+		positions:  positions,
+		foodNeeded: server.foodNeeded(len(positions)),
+		effects:    map[string]time.Time{},
+	}
+
+	server.worms[id] = worm
+
+	for _, position := range positions {
+		server.grid[position.x][position.y].worm = id
+	}
+
+	return worm
+}
+
+// dialTestConn returns the server side of a real websocket connection opened
+// with query, eg. name=wormy, closed when the test ends.
+func dialTestConn(t *testing.T, query string) *websocket.Conn {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn)
+	done := make(chan struct{})
+
+	httpServer := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		conns <- ws
+		<-done
+	}))
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/?" + query
+	client, error := websocket.Dial(url, "", httpServer.URL)
+
+	if error != nil {
+		t.Fatal(error)
+	}
+
+	ws := <-conns
+
+	t.Cleanup(func() {
+		client.Close()
+		close(done)
+		httpServer.Close()
+	})
+
+	return ws
+}
@@ -0,0 +1,43 @@
+package websocket
+
+import (
+	"strconv"
+
+	"golang.org/x/net/websocket"
+)
+
+// isSpectator reports whether ws asked to watch rather than play by connecting
+// with a spectate query parameter, eg. ws://wormo.example:8001/?spectate
+func isSpectator(ws *websocket.Conn) bool {
+	return ws.Request().URL.Query().Has("spectate")
+}
+
+func (server *Server) spectatorCountMsg() []byte {
+	server.mu.RLock()
+	count := len(server.spectators)
+	server.mu.RUnlock()
+
+	return []byte(eventSpectators + "\n" + strconv.Itoa(count))
+}
+
+// makeSpectator takes the worm away from a player, leaving them watching.
+func (server *Server) makeSpectator(ws *websocket.Conn) {
+	server.mu.Lock()
+
+	id, isPlayer := server.wormConns[ws]
+
+	if !isPlayer {
+		server.mu.Unlock()
+		return
+	}
+
+	server.removeWorm(ws, id)
+	server.spectators[ws] = true
+
+	server.mu.Unlock()
+
+	server.broadcast([]byte(eventDisconnect + "\n" + id))
+	server.broadcast(server.spectatorCountMsg())
+
+	server.promoteQueued()
+}
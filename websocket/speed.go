@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// moveTickInterval is how often worms are given movement, they move a cell
+	// each time they have built up movePoints.
+	moveTickInterval = 100 * time.Millisecond
+	// normalSpeed moves a worm one cell every wormMoveInterval.
+	normalSpeed = 100
+	movePoints  = normalSpeed * int(wormMoveInterval/moveTickInterval)
+	minSpeed    = 50
+	// slowdownPerCell is the speed lost for every cell a worm is longer than
+	// SlowdownFromLength.
+	slowdownPerCell = 2
+	boostDuration   = 2 * time.Second
+	minBoostLength  = 2
+)
+
+// effectBoost is the effect worms get for spending length on a BOOST.
+const effectBoost = "BOOST"
+
+// speed returns the movement worm builds up every moveTickInterval. It must be
+// called with server.mu held.
+func (server *Server) speed(worm *worm) int {
+	speed := normalSpeed
+
+	if server.config.SlowdownFromLength > 0 && len(worm.positions) > server.config.SlowdownFromLength {
+		speed = max(speed-(len(worm.positions)-server.config.SlowdownFromLength)*slowdownPerCell, minSpeed)
+	}
+
+	if worm.hasEffect(itemSpeed) || worm.hasEffect(effectBoost) {
+		speed *= 2
+	}
+
+	return speed
+}
+
+// advance builds up the worm id's movement and moves it a cell for every
+// movePoints it has, stopping early if it runs into something. It reports
+// whether the worm moved.
+func (server *Server) advance(id string, worm *worm, collisions *map[string]*collisionInfo) bool {
+	server.mu.Lock()
+	worm.moveProgress += server.speed(worm)
+	server.mu.Unlock()
+
+	moved := false
+
+	for {
+		server.mu.Lock()
+
+		if worm.moveProgress < movePoints {
+			server.mu.Unlock()
+			break
+		}
+
+		worm.moveProgress -= movePoints
+
+		if worm.idleActionTaken && server.config.IdleAction == IdleActionBot {
+			worm.queueDirection(server.botDirection(worm))
+		}
+
+		dir := worm.nextDirection()
+
+		server.mu.Unlock()
+
+		server.move(id, dir, collisions)
+		moved = true
+
+		if collison, didCollide := (*collisions)[id]; didCollide && collison.loss {
+			break
+		}
+	}
+
+	return moved
+}
+
+// handleBoost doubles the worm id's speed for a while in exchange for
+// BoostCost cells of its length.
+func (server *Server) handleBoost(id string) {
+	server.mu.Lock()
+
+	worm, ok := server.worms[id]
+	cost := server.config.BoostCost
+
+	if !ok || cost <= 0 || worm.hasEffect(effectBoost) || len(worm.positions)-cost < minBoostLength {
+		server.mu.Unlock()
+		return
+	}
+
+	newLength := len(worm.positions) - cost
+	kept := worm.positions[:newLength]
+
+	for _, position := range worm.positions[newLength:] {
+		//a worm that has just grown has its tail cell more than once
+		if !containsPos(kept, position) {
+			server.vacate(id, position)
+		}
+	}
+
+	worm.positions = kept
+	worm.foodConsumed = 0
+	worm.foodNeeded = server.foodNeeded(newLength)
+	worm.effects[effectBoost] = time.Now().Add(boostDuration)
+
+	moveMsg := eventMove + "\n" + id + "," + positionsToString(worm.positions)
+	progress := progressMsg(worm)
+
+	server.mu.Unlock()
+
+	server.broadcast([]byte(moveMsg))
+	server.sendTo(id, progress)
+	server.broadcast([]byte(eventBoost + "\n" + id + "|" + strconv.FormatInt(boostDuration.Milliseconds(), 10)))
+}
+
+func containsPos(positions []pos, position pos) bool {
+	for _, p := range positions {
+		if p == position {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+// testWormPositions returns length cells in a row along y = 10, head first at
+// x = length.
+func testWormPositions(length int) []pos {
+	positions := []pos{}
+
+	for i := 0; i < length; i++ {
+		positions = append(positions, pos{length - i, 10})
+	}
+
+	return positions
+}
+
+func TestSpeed(t *testing.T) {
+	tests := []struct {
+		name         string
+		slowdownFrom int
+		length       int
+		effect       string
+		speed        int
+	}{
+		{"normal", 0, 20, "", normalSpeed},
+		{"at the slowdown length", 5, 5, "", normalSpeed},
+		{"slowed", 5, 10, "", normalSpeed - 5*slowdownPerCell},
+		{"slowest", 5, 100, "", minSpeed},
+		{"speed item", 0, 3, itemSpeed, 2 * normalSpeed},
+		{"boosted", 0, 3, effectBoost, 2 * normalSpeed},
+		{"slowed and boosted", 5, 10, effectBoost, 2 * (normalSpeed - 5*slowdownPerCell)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 120, 20, Config{SlowdownFromLength: test.slowdownFrom})
+			worm := addTestWorm(server, "1", 0, "R", testWormPositions(test.length)...)
+
+			if test.effect != "" {
+				worm.effects[test.effect] = time.Now().Add(time.Minute)
+			}
+
+			if speed := server.speed(worm); speed != test.speed {
+				t.Fatalf("speed is %d, expected %d", speed, test.speed)
+			}
+		})
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	tests := []struct {
+		name         string
+		boosted      bool
+		blocked      bool
+		progress     int
+		moved        int
+		wantProgress int
+	}{
+		{"builds up", false, false, 0, 0, normalSpeed},
+		{"moves once", false, false, movePoints - normalSpeed, 1, 0},
+		{"moves twice", true, false, 2*movePoints - 2*normalSpeed, 2, 0},
+		{"stops after a collision", true, true, 3*movePoints - 2*normalSpeed, 1, movePoints},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{})
+			worm := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+			worm.moveProgress = test.progress
+
+			if test.boosted {
+				worm.effects[effectBoost] = time.Now().Add(time.Minute)
+			}
+
+			if test.blocked {
+				addTestWorm(server, "2", 0, "U", pos{7, 4}, pos{7, 5}, pos{7, 6})
+			}
+
+			collisions := map[string]*collisionInfo{}
+			moved := server.advance("1", worm, &collisions)
+
+			if moved != (test.moved > 0) {
+				t.Fatalf("reported moving %v, expected %d moves", moved, test.moved)
+			}
+
+			if head := worm.positions[0]; head != (pos{5 + test.moved, 5}) {
+				t.Fatalf("head is at %v after %d moves", head, test.moved)
+			}
+
+			if worm.moveProgress != test.wantProgress {
+				t.Fatalf("%d movement left, expected %d", worm.moveProgress, test.wantProgress)
+			}
+		})
+	}
+}
+
+func TestHandleBoost(t *testing.T) {
+	tests := []struct {
+		name       string
+		cost       int
+		positions  []pos
+		boosted    bool
+		wantLength int
+		vacated    []pos
+	}{
+		{"trims the tail", 2, testWormPositions(5), false, 3, []pos{{2, 10}, {1, 10}}},
+		{"keeps a grown tail's cell", 1, append(testWormPositions(3), pos{1, 10}), false, 3, nil},
+		{"too short", 2, testWormPositions(3), false, 3, nil},
+		{"already boosted", 2, testWormPositions(5), true, 5, nil},
+		{"disabled", 0, testWormPositions(5), false, 5, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{BoostCost: test.cost})
+			worm := addTestWorm(server, "1", 0, "R", test.positions...)
+			worm.foodConsumed = 1
+
+			if test.boosted {
+				worm.effects[effectBoost] = time.Now().Add(time.Minute)
+			}
+
+			server.handleBoost("1")
+
+			if len(worm.positions) != test.wantLength {
+				t.Fatalf("worm is %d long, expected %d", len(worm.positions), test.wantLength)
+			}
+
+			for _, position := range worm.positions {
+				if server.grid[position.x][position.y].worm != "1" {
+					t.Fatalf("the worm lost its cell at %v", position)
+				}
+			}
+
+			for _, position := range test.vacated {
+				if server.grid[position.x][position.y].worm != "" {
+					t.Fatalf("%v was not vacated", position)
+				}
+			}
+
+			boosted := len(worm.positions) < len(test.positions)
+
+			if boosted && (!worm.hasEffect(effectBoost) || worm.foodConsumed != 0) {
+				t.Fatal("the boost was paid for but not given")
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+var turnDirections = map[string][]string{
+	"U": {"L", "R"},
+	"D": {"L", "R"},
+	"L": {"U", "D"},
+	"R": {"U", "D"},
+}
+
+// assignTeam picks the team with the fewest worms, 0 when team mode is off.
+// It must be called with server.mu held.
+func (server *Server) assignTeam() int {
+	if server.config.Teams <= 0 {
+		return 0
+	}
+
+	counts := make([]int, server.config.Teams+1)
+
+	for _, worm := range server.worms {
+		counts[worm.team]++
+	}
+
+	team := 1
+
+	for i := 2; i <= server.config.Teams; i++ {
+		if counts[i] < counts[team] {
+			team = i
+		}
+	}
+
+	return team
+}
+
+func (server *Server) isTeammate(worm *worm, otherId string) bool {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	other, ok := server.worms[otherId]
+
+	return ok && worm.team != 0 && worm.team == other.team
+}
+
+// bounce turns worm, which was moving in dir, away from the teammate in front of
+// it onto a free cell to either side, or reverses it if both are blocked. It
+// returns the direction to move in instead, empty if the worm is boxed in. It
+// must be called with server.mu held.
+func (server *Server) bounce(worm *worm, dir string) string {
+	free := func(position pos, dir string) bool {
+		next, ok := server.step(position, dir)
+
+		if !ok {
+			return false
+		}
+
+		cell := server.grid[next.x][next.y]
+
+		return !cell.wall && cell.worm == ""
+	}
+
+	turns := append([]string{}, turnDirections[dir]...)
+
+	if rand.Intn(2) == 0 {
+		turns[0], turns[1] = turns[1], turns[0]
+	}
+
+	for _, turn := range turns {
+		if free(worm.positions[0], turn) {
+			worm.direction = turn
+			worm.queuedDirections = nil
+
+			return turn
+		}
+	}
+
+	reversed := make([]pos, len(worm.positions))
+
+	for i, position := range worm.positions {
+		reversed[len(reversed)-1-i] = position
+	}
+
+	//the tail leads, moving away from the rest of the body
+	back := oppositeDirections[dir]
+
+	for _, position := range reversed[1:] {
+		if position == reversed[0] {
+			continue
+		}
+
+		for candidate := range oppositeDirections {
+			if next, _ := server.step(position, candidate); next == reversed[0] {
+				back = candidate
+			}
+		}
+
+		break
+	}
+
+	if !free(reversed[0], back) {
+		return ""
+	}
+
+	worm.positions = reversed
+	worm.direction = back
+	worm.queuedDirections = nil
+
+	return back
+}
+
+// teamsMsg lists the team of each worm as ID,TEAM lines.
+// It must be called with server.mu held.
+func (server *Server) teamsMsg() string {
+	msg := ""
+
+	for id, worm := range server.worms {
+		if msg != "" {
+			msg += "\n"
+		}
+
+		msg += id + "," + strconv.Itoa(worm.team)
+	}
+
+	return msg
+}
+
+// scoresMsg totals the length of every worm in each team, a team's score.
+func (server *Server) scoresMsg() string {
+	scores := make([]int, server.config.Teams+1)
+
+	server.mu.RLock()
+
+	for _, worm := range server.worms {
+		scores[worm.team] += len(worm.positions)
+	}
+
+	server.mu.RUnlock()
+
+	teams := make([]int, server.config.Teams)
+
+	for i := range teams {
+		teams[i] = i + 1
+	}
+
+	sort.SliceStable(teams, func(i, j int) bool {
+		return scores[teams[i]] > scores[teams[j]]
+	})
+
+	msg := eventScores
+
+	for _, team := range teams {
+		msg += "\n" + strconv.Itoa(team) + "," + strconv.Itoa(scores[team])
+	}
+
+	return msg
+}
+
+// broadcastScores sends the scoreboard to everyone if it has changed.
+func (server *Server) broadcastScores() {
+	if server.config.Teams <= 0 {
+		return
+	}
+
+	msg := server.scoresMsg()
+
+	server.mu.Lock()
+	changed := msg != server.lastScoresMsg
+	server.lastScoresMsg = msg
+	server.mu.Unlock()
+
+	if changed {
+		server.broadcast([]byte(msg))
+	}
+}
@@ -0,0 +1,86 @@
+package websocket
+
+import "testing"
+
+func TestFriendlyFirePass(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{Teams: 2, FriendlyFire: FriendlyFirePass})
+	passing := addTestWorm(server, "1", 1, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+	addTestWorm(server, "2", 1, "U", pos{6, 4}, pos{6, 5}, pos{6, 6})
+	collisions := map[string]*collisionInfo{}
+
+	server.move("1", "R", &collisions)
+
+	if passing.positions[0] != (pos{6, 5}) {
+		t.Fatalf("head is at %v, expected it on its teammate at 6:5", passing.positions[0])
+	}
+
+	if server.grid[6][5].worm != "2" {
+		t.Fatalf("6:5 belongs to %q, expected the teammate to keep it", server.grid[6][5].worm)
+	}
+
+	//the whole worm slides off its teammate again
+	for i := 0; i < 3; i++ {
+		server.move("1", "R", &collisions)
+	}
+
+	if server.grid[6][5].worm != "2" {
+		t.Fatalf("6:5 belongs to %q after passing, expected the teammate", server.grid[6][5].worm)
+	}
+}
+
+func TestFriendlyFirePassHandsCellsBack(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{Teams: 2, FriendlyFire: FriendlyFirePass})
+	addTestWorm(server, "1", 1, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+	addTestWorm(server, "2", 1, "D", pos{6, 7}, pos{6, 6}, pos{6, 5})
+	collisions := map[string]*collisionInfo{}
+
+	server.move("1", "R", &collisions)
+	server.move("2", "D", &collisions)
+
+	if server.grid[6][5].worm != "1" {
+		t.Fatalf("6:5 belongs to %q once the teammate left, expected the worm still on it", server.grid[6][5].worm)
+	}
+}
+
+func TestFriendlyFireBounce(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockers  [][]pos
+		heads     []pos
+		direction string
+	}{
+		{"turns aside", nil, []pos{{5, 4}, {5, 6}}, ""},
+		{"reverses when boxed in", [][]pos{{{5, 4}, {5, 3}}, {{5, 6}, {5, 7}}}, []pos{{2, 5}}, "L"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{Teams: 2, FriendlyFire: FriendlyFireBounce})
+			bouncing := addTestWorm(server, "1", 1, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+			addTestWorm(server, "2", 1, "U", pos{6, 4}, pos{6, 5}, pos{6, 6})
+
+			for i, blocker := range test.blockers {
+				addTestWorm(server, string(rune('3'+i)), 1, "U", blocker...)
+			}
+
+			collisions := map[string]*collisionInfo{}
+			server.move("1", "R", &collisions)
+
+			if !containsPos(test.heads, bouncing.positions[0]) {
+				t.Fatalf("head is at %v, expected one of %v", bouncing.positions[0], test.heads)
+			}
+
+			if test.direction != "" && bouncing.direction != test.direction {
+				t.Fatalf("moving %s, expected %s", bouncing.direction, test.direction)
+			}
+
+			if server.grid[6][5].worm != "2" || server.grid[bouncing.positions[0].x][bouncing.positions[0].y].worm != "1" {
+				t.Fatal("bouncing changed who owns the cells")
+			}
+
+			if len(bouncing.positions) != 3 || bouncing.eliminated {
+				t.Fatalf("worm is %d long, eliminated %v, expected it unharmed", len(bouncing.positions), bouncing.eliminated)
+			}
+		})
+	}
+}
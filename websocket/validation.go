@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"time"
+)
+
+const (
+	defaultMaxMessageSize = 512
+	clientMessageRate     = 10
+	clientMessageBurst    = 20
+	// maxClientViolations is how many rejected messages a client can send in
+	// a row before being disconnected, one is forgiven every
+	// clientViolationForgiveness so well-behaved clients are never disconnected
+	// for the odd mistake.
+	maxClientViolations        = 10
+	clientViolationForgiveness = 30 * time.Second
+)
+
+const (
+	errorMessageSize  = "MSGSIZE"
+	errorUnknownEvent = "UNKNOWNEVENT"
+	errorBadData      = "BADDATA"
+	errorRateLimit    = "RATELIMIT"
+	errorMuted        = "MUTED"
+)
+
+var validDirections = map[string]bool{
+	"U": true,
+	"D": true,
+	"L": true,
+	"R": true,
+}
+
+// rateLimiter is a token bucket refilled at rate tokens a second, holding at
+// most burst tokens.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst float64) *rateLimiter {
+	return &rateLimiter{rate, burst, burst, time.Now()}
+}
+
+func (limiter *rateLimiter) allow() bool {
+	now := time.Now()
+
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	limiter.last = now
+
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+
+	if limiter.tokens < 1 {
+		return false
+	}
+
+	limiter.tokens--
+
+	return true
+}
+
+// validateEvent returns the ERROR code to reply with if a client event is
+// malformed, or an empty string if it is valid.
+func validateEvent(event string, data string, hasData bool) string {
+	switch event {
+	case eventInit, eventPong, eventBoost:
+		if hasData {
+			return errorBadData
+		}
+	case eventChangeDirection:
+		if !validDirections[data] {
+			return errorBadData
+		}
+	case eventChat:
+		if !validChatMessage(data) {
+			return errorBadData
+		}
+	case eventDropBomb:
+		if hasData && !bombKinds[data] {
+			return errorBadData
+		}
+	default:
+		return errorUnknownEvent
+	}
+
+	return ""
+}
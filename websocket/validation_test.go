@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateEvent(t *testing.T) {
+	tests := []struct {
+		event   string
+		data    string
+		hasData bool
+		want    string
+	}{
+		{eventInit, "", false, ""},
+		{eventInit, "", true, errorBadData},
+		{eventPong, "", false, ""},
+		{eventBoost, "x", true, errorBadData},
+		{eventChangeDirection, "U", true, ""},
+		{eventChangeDirection, "R", true, ""},
+		{eventChangeDirection, "", false, errorBadData},
+		{eventChangeDirection, "up", true, errorBadData},
+		{eventChangeDirection, "u", true, errorBadData},
+		{eventChat, "hello", true, ""},
+		{eventChat, "", true, errorBadData},
+		{eventChat, strings.Repeat("a", maxChatLength+1), true, errorBadData},
+		{eventDropBomb, "", false, ""},
+		{eventDropBomb, bombMine, true, ""},
+		{eventDropBomb, "NUKE", true, errorBadData},
+		{"NEW", "", false, errorUnknownEvent},
+		{"", "", false, errorUnknownEvent},
+	}
+
+	for _, test := range tests {
+		if got := validateEvent(test.event, test.data, test.hasData); got != test.want {
+			t.Errorf("validateEvent(%q, %q, %v) = %q, expected %q", test.event, test.data, test.hasData, got, test.want)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.allow() {
+			t.Fatalf("message %d of the burst was refused", i+1)
+		}
+	}
+
+	if limiter.allow() {
+		t.Fatal("a message over the burst was allowed")
+	}
+
+	//half a second refills one token at 2 a second
+	limiter.last = limiter.last.Add(-500 * time.Millisecond)
+
+	if !limiter.allow() {
+		t.Fatal("the bucket did not refill")
+	}
+
+	if limiter.allow() {
+		t.Fatal("the bucket refilled too much")
+	}
+
+	//a long wait only refills up to the burst
+	limiter.last = limiter.last.Add(-time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if !limiter.allow() {
+			t.Fatalf("message %d after waiting was refused", i+1)
+		}
+	}
+
+	if limiter.allow() {
+		t.Fatal("the bucket filled past its burst")
+	}
+}
+
+func TestViolationsAreForgiven(t *testing.T) {
+	violations := newRateLimiter(1/clientViolationForgiveness.Seconds(), maxClientViolations)
+
+	//a long lived client making the odd mistake is never disconnected
+	for i := 0; i < maxClientViolations*5; i++ {
+		if !violations.allow() {
+			t.Fatalf("disconnected after %d occasional violations", i+1)
+		}
+
+		violations.last = violations.last.Add(-clientViolationForgiveness)
+	}
+
+	violations = newRateLimiter(1/clientViolationForgiveness.Seconds(), maxClientViolations)
+
+	for i := 0; i < maxClientViolations; i++ {
+		violations.allow()
+	}
+
+	if violations.allow() {
+		t.Fatal("a client sending nothing but bad messages was not disconnected")
+	}
+}
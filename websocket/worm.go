@@ -1,43 +1,155 @@
 package websocket
 
 import (
+	"errors"
 	"math/rand"
 	"strconv"
 	"sync/atomic"
+	"time"
+	"wormo/gamemap"
 )
 
+// maxQueuedDirections is how many direction changes a worm can buffer ahead of
+// its moves, one is consumed each move.
+const maxQueuedDirections = 3
+
+const maxSpawnAttempts = 20
+
+// maxSpawnMargin is how far from the edges of large grids worms spawn.
+const maxSpawnMargin = 5
+
+// spawnInvulnerability is how long a new or respawned worm can't lose length.
+const spawnInvulnerability = 3 * time.Second
+
+var errNoSpawn = errors.New("no free space to spawn")
+
+var oppositeDirections = map[string]string{
+	"U": "D",
+	"D": "U",
+	"L": "R",
+	"R": "L",
+}
+
 type pos struct {
 	x int
 	y int
 }
 
 type worm struct {
-	positions    []pos
-	direction    string
-	foodConsumed int
-	foodNeeded   int
+	name             string
+	team             int
+	positions        []pos
+	direction        string
+	queuedDirections []string
+	foodConsumed     int
+	foodNeeded       int
+	lastInput        time.Time
+	idleWarned       bool
+	idleActionTaken  bool
+	eliminated       bool
+	invulnerableTill time.Time
+	effects          map[string]time.Time
+	heldBombs        int
+	foodTowardsBomb  int
+	lastBombDropped  time.Time
+	kills            int
+	moveProgress     int
+}
+
+// invulnerable reports whether worm is still protected after spawning.
+func (worm *worm) invulnerable() bool {
+	return time.Now().Before(worm.invulnerableTill)
+}
+
+// queueDirection buffers dir to be applied on a later move, ignoring repeats
+// and reversals into the worm's own body. It must be called with server.mu held.
+func (worm *worm) queueDirection(dir string) {
+	lastDir := worm.direction
+
+	if len(worm.queuedDirections) > 0 {
+		lastDir = worm.queuedDirections[len(worm.queuedDirections)-1]
+	}
+
+	if dir == lastDir || len(worm.queuedDirections) >= maxQueuedDirections {
+		return
+	}
+
+	if oppositeDirections[lastDir] == dir && len(worm.positions) > 1 {
+		return
+	}
+
+	worm.queuedDirections = append(worm.queuedDirections, dir)
+}
+
+// nextDirection applies the oldest queued direction change, if any, and returns
+// the direction to move in. It must be called with server.mu held.
+func (worm *worm) nextDirection() string {
+	if len(worm.queuedDirections) > 0 {
+		worm.direction = worm.queuedDirections[0]
+		worm.queuedDirections = worm.queuedDirections[1:]
+	}
+
+	return worm.direction
 }
 
 type cellInfo struct {
-	worm string
-	food bool
+	worm        string
+	food        bool
+	wall        bool
+	item        string
+	foodKind    string
+	foodExpires time.Time
 }
 
-func (server *Server) reduce(worm *worm, amount int) {
+func (server *Server) reduce(id string, worm *worm, amount int) {
+	server.shrink(id, worm, amount, false)
+}
+
+// shrink takes amount off the length of the worm id, dropping the cells it
+// loses as food. Worms that were poisoned lose the cells outright, and shields
+// only protect against damage, not what a worm eats.
+func (server *Server) shrink(id string, worm *worm, amount int, poisoned bool) {
+	drop := !poisoned
+
 	server.mu.RLock()
+	invulnerable := worm.invulnerable()
 	newLength := len(worm.positions) - amount
+	eliminate := newLength <= 1 && server.battleRoyaleInProgress()
+	//a worm of length 1 has nothing left to lose outside battle royale
+	harmless := !eliminate && max(newLength, 1) >= len(worm.positions)
 	server.mu.RUnlock()
 
-	if newLength < 1 {
+	if invulnerable || (!harmless && !poisoned && server.useShield(worm)) {
+		return
+	}
+
+	var dropped []pos
+
+	if eliminate {
+		server.mu.Lock()
+		server.eliminate(id, worm)
+
+		if drop {
+			dropped = server.dropFood(worm.positions)
+		}
+
+		server.mu.Unlock()
+	} else if newLength < 1 {
 		server.mu.Lock()
 
 		for i := 1; i < len(worm.positions); i++ {
-			server.grid[worm.positions[i].x][worm.positions[i].y].worm = ""
+			if worm.positions[i] != worm.positions[0] {
+				server.vacate(id, worm.positions[i])
+			}
+		}
+
+		if drop {
+			dropped = server.dropFood(worm.positions[1:])
 		}
 
 		worm.positions = []pos{worm.positions[0]}
 		worm.foodConsumed = 0
-		worm.foodNeeded = 1
+		worm.foodNeeded = server.foodNeeded(1)
 
 		server.mu.Unlock()
 	} else {
@@ -48,20 +160,59 @@ func (server *Server) reduce(worm *worm, amount int) {
 		for i := 0; i < len(worm.positions); i++ {
 			if i < newLength {
 				newPositions[i] = worm.positions[i]
-			} else {
-				server.grid[worm.positions[i].x][worm.positions[i].y].worm = ""
+			} else if !containsPos(newPositions, worm.positions[i]) {
+				server.vacate(id, worm.positions[i])
 			}
 		}
 
+		if drop {
+			dropped = server.dropFood(worm.positions[newLength:])
+		}
+
 		worm.positions = newPositions
 		worm.foodConsumed = 0
-		worm.foodNeeded = newLength * server.levelMultiplier
+		worm.foodNeeded = server.foodNeeded(newLength)
 
 		server.mu.Unlock()
 	}
+
+	if !eliminate {
+		server.mu.RLock()
+		msg := progressMsg(worm)
+		server.mu.RUnlock()
+
+		server.sendTo(id, msg)
+	}
+
+	if len(dropped) > 0 {
+		server.mu.RLock()
+		foodMsg := server.foodMsg(dropped)
+		server.mu.RUnlock()
+
+		server.broadcast([]byte(eventSpawnFood + "\n" + foodMsg))
+	}
 }
 
-func (server *Server) extend(worm *worm, amount int) {
+// dropFood turns the cells a worm has lost into food, returning the ones that
+// were free to. It must be called with server.mu held.
+func (server *Server) dropFood(positions []pos) []pos {
+	var dropped []pos
+
+	for _, position := range positions {
+		cell := &server.grid[position.x][position.y]
+
+		if cell.worm != "" || cell.food || cell.wall || cell.item != "" {
+			continue
+		}
+
+		server.placeFood(position, FoodCommon)
+		dropped = append(dropped, position)
+	}
+
+	return dropped
+}
+
+func (server *Server) extend(id string, worm *worm, amount int) {
 	server.mu.RLock()
 
 	oldWormLength := len(worm.positions)
@@ -87,27 +238,67 @@ func (server *Server) extend(worm *worm, amount int) {
 
 	server.mu.Lock()
 
-	worm.foodConsumed = 0
-	worm.foodNeeded = (oldWormLength + 1) * server.levelMultiplier
+	//food eaten past what the worm needed counts towards its next length
+	worm.foodConsumed = max(worm.foodConsumed-worm.foodNeeded, 0)
+	worm.foodNeeded = server.foodNeeded(len(newWormPositions))
 	worm.positions = newWormPositions
 
+	msg := levelUpMsg(id, worm)
+
 	server.mu.Unlock()
+
+	server.broadcast(msg)
+}
+
+func (server *Server) readyToGrow(worm *worm) bool {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	return worm.foodConsumed >= worm.foodNeeded
 }
 
 func (server *Server) consumeFood(id string, headPosCell *cellInfo, headPos *pos) {
 	server.mu.Lock()
 	worm := server.worms[id]
 
+	//a magnet may have pulled the food in first
+	if !headPosCell.food {
+		server.mu.Unlock()
+		return
+	}
+
+	kind := headPosCell.foodKind
+	value := foodValues[kind]
+
 	headPosCell.food = false
-	worm.foodConsumed++
+	headPosCell.foodKind = ""
+
+	var bombsMsg []byte
+
+	if value > 0 {
+		worm.foodConsumed += value
+
+		if server.earnBomb(worm) {
+			bombsMsg = server.bombsMsg(worm)
+		}
+	}
 
 	server.mu.Unlock()
 
-	if worm.foodConsumed == worm.foodNeeded {
-		server.extend(worm, 1)
+	if bombsMsg != nil {
+		server.sendTo(id, bombsMsg)
+	}
+
+	if value < 0 {
+		server.shrink(id, worm, -value, true)
+	} else {
+		//golden food can be worth more than one length
+		for server.readyToGrow(worm) {
+			server.extend(id, worm, 1)
+		}
 	}
 
-	server.broadcast([]byte(eventConsumeFood + "\n" + id + "," + positionToString(headPos) + "|" + strconv.Itoa(worm.foodConsumed) + "/" + strconv.Itoa(worm.foodNeeded)))
+	server.broadcast([]byte(eventConsumeFood + "\n" + id + "," + positionToString(headPos) + "|" + strconv.Itoa(worm.foodConsumed) + "/" + strconv.Itoa(worm.foodNeeded) + "|" + kind))
 }
 
 func (server *Server) move(id string, dir string, collisions *map[string]*collisionInfo) {
@@ -121,18 +312,9 @@ func (server *Server) move(id string, dir string, collisions *map[string]*collis
 
 	server.mu.RUnlock()
 
-	switch dir {
-	case "U":
-		headPos.y--
-	case "D":
-		headPos.y++
-	case "L":
-		headPos.x--
-	case "R":
-		headPos.x++
-	}
-
-	outOfBounds := headPos.x == -1 || headPos.x == server.gridWidth || headPos.y == -1 || headPos.y == server.gridHeight
+	headPos, inBounds := server.step(headPos, dir)
+	//walls are treated like the edge of the grid
+	outOfBounds := !inBounds || server.grid[headPos.x][headPos.y].wall
 
 	collison, existingCollision := (*collisions)[id]
 
@@ -151,6 +333,35 @@ func (server *Server) move(id string, dir string, collisions *map[string]*collis
 
 	enemyWormId := server.grid[headPos.x][headPos.y].worm
 
+	if enemyWormId != id && enemyWormId != "" {
+		server.mu.RLock()
+		ghost := worm.hasEffect(itemGhost) || server.worms[enemyWormId].hasEffect(itemGhost)
+		server.mu.RUnlock()
+
+		//ghosts pass through other worms and other worms through them, leaving
+		//them their cells
+		if ghost {
+			enemyWormId = ""
+		}
+	}
+
+	if enemyWormId != id && enemyWormId != "" && server.isTeammate(worm, enemyWormId) {
+		if server.config.FriendlyFire != FriendlyFirePass {
+			server.mu.Lock()
+			bounceDir := server.bounce(worm, dir)
+			server.mu.Unlock()
+
+			if bounceDir != "" {
+				server.move(id, bounceDir, collisions)
+			}
+
+			return
+		}
+
+		//teammates slide over each other without colliding
+		enemyWormId = ""
+	}
+
 	if enemyWormId != id && enemyWormId != "" {
 		server.mu.RLock()
 		enemyWorm := server.worms[enemyWormId]
@@ -161,6 +372,11 @@ func (server *Server) move(id string, dir string, collisions *map[string]*collis
 			return
 		}
 
+		//a protected worm stops instead of feeding the worm it ran into
+		if worm.invulnerable() || server.useShield(worm) {
+			return
+		}
+
 		if existingCollision {
 			collison.loss = true
 		} else {
@@ -208,16 +424,75 @@ func (server *Server) move(id string, dir string, collisions *map[string]*collis
 	headPosCell := &server.grid[headPos.x][headPos.y]
 
 	if !tailPosOverlap {
-		server.grid[tailPos.x][tailPos.y].worm = ""
+		server.vacate(id, tailPos)
 	}
 
-	headPosCell.worm = id
+	//a worm passing over another leaves the cell to it until it moves off
+	if headPosCell.worm == "" {
+		headPosCell.worm = id
+	}
+	magnet := worm.hasEffect(itemMagnet)
+
+	server.triggerMines(id, headPos)
 
 	server.mu.Unlock()
 
 	if headPosCell.food {
 		server.consumeFood(id, headPosCell, &headPos)
 	}
+
+	server.consumeItem(id, headPos)
+
+	if magnet {
+		server.attractFood(id, headPos)
+	}
+}
+
+// vacate takes the worm id off the cell at position, handing the cell to any
+// other worm that has passed over it. It must be called with server.mu held.
+func (server *Server) vacate(id string, position pos) {
+	cell := &server.grid[position.x][position.y]
+
+	if cell.worm != id {
+		return
+	}
+
+	cell.worm = ""
+
+	for otherId, other := range server.worms {
+		if otherId != id && !other.eliminated && containsPos(other.positions, position) {
+			cell.worm = otherId
+			return
+		}
+	}
+}
+
+// step returns the cell next to position in dir, wrapping around to the other
+// side of the grid if enabled, and false if it is off the grid.
+func (server *Server) step(position pos, dir string) (pos, bool) {
+	switch dir {
+	case "U":
+		position.y--
+	case "D":
+		position.y++
+	case "L":
+		position.x--
+	case "R":
+		position.x++
+	}
+
+	if server.config.WrapEdges {
+		return server.wrap(position), true
+	}
+
+	return position, position.x >= 0 && position.x < server.gridWidth && position.y >= 0 && position.y < server.gridHeight
+}
+
+func (server *Server) wrap(position pos) pos {
+	return pos{
+		(position.x%server.gridWidth + server.gridWidth) % server.gridWidth,
+		(position.y%server.gridHeight + server.gridHeight) % server.gridHeight,
+	}
 }
 
 func positionToString(position *pos) string {
@@ -238,20 +513,212 @@ func positionsToString(positions []pos) string {
 	return positionsString
 }
 
-func (server *Server) newWorm() string {
+// spawnAt returns the cells of a new worm with its head at x, y, facing right,
+// and false if any of them, or the cells in front of the head, are off the grid
+// or on a wall, worm or bomb blast. It must be called with server.mu held.
+func (server *Server) spawnAt(x int, y int, blasts map[pos]bool) ([]pos, bool) {
+	positions := []pos{{x, y}, {x - 1, y}, {x - 2, y}}
+
+	for dx := -2; dx <= gamemap.SpawnClearance; dx++ {
+		position := pos{x + dx, y}
+
+		if position.x < 0 || position.x >= server.gridWidth || position.y < 0 || position.y >= server.gridHeight || blasts[position] {
+			return nil, false
+		}
+
+		cell := server.grid[position.x][position.y]
+
+		if cell.wall || cell.worm != "" || (dx <= 0 && (cell.food || cell.item != "")) {
+			return nil, false
+		}
+	}
+
+	return positions, true
+}
+
+// headDistance returns how far position is from the nearest of heads.
+func (server *Server) headDistance(position pos, heads []pos) int {
+	nearest := server.gridWidth + server.gridHeight
+
+	for _, head := range heads {
+		dx := abs(position.x - head.x)
+		dy := abs(position.y - head.y)
+
+		if server.config.WrapEdges {
+			dx = min(dx, server.gridWidth-dx)
+			dy = min(dy, server.gridHeight-dy)
+		}
+
+		nearest = min(nearest, dx+dy)
+	}
+
+	return nearest
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+// spawnPositions picks the free spot furthest from other worms' heads out of a
+// number of candidates, preferring the map's spawn zones if it has any, and
+// errNoSpawn if the grid has no free spot left. It must be called with
+// server.mu held.
+func (server *Server) spawnPositions() ([]pos, error) {
+	blasts := map[pos]bool{}
+
+	for _, bomb := range server.bombs {
+		for _, position := range bomb.positions {
+			blasts[position] = true
+		}
+	}
+
+	heads := []pos{}
+
+	for _, worm := range server.worms {
+		if len(worm.positions) > 0 {
+			heads = append(heads, worm.positions[0])
+		}
+	}
+
+	var best []pos
+	bestDistance := -1
+
+	try := func(x int, y int) {
+		positions, ok := server.spawnAt(x, y, blasts)
+
+		if !ok {
+			return
+		}
+
+		if distance := server.headDistance(positions[0], heads); distance > bestDistance {
+			best = positions
+			bestDistance = distance
+		}
+	}
+
+	for i := 0; i < maxSpawnAttempts && len(server.spawnCells) > 0; i++ {
+		head := server.spawnCells[rand.Intn(len(server.spawnCells))]
+		try(head.x, head.y)
+	}
+
+	for i := 0; i < maxSpawnAttempts && best == nil; i++ {
+		try(randomSpawnCoord(server.gridWidth), randomSpawnCoord(server.gridHeight))
+	}
+
+	//a crowded grid may only have a few free spots left for random tries to miss
+	for x := 0; x < server.gridWidth && best == nil; x++ {
+		for y := 0; y < server.gridHeight; y++ {
+			try(x, y)
+		}
+	}
+
+	if best == nil {
+		return nil, errNoSpawn
+	}
+
+	return best, nil
+}
+
+// randomSpawnCoord picks a coordinate for a spawning head away from the edges
+// of a side of the grid size cells long, keeping less of a margin on small grids.
+func randomSpawnCoord(size int) int {
+	margin := min(maxSpawnMargin, size/4)
+
+	return rand.Intn(max(size-2*margin, 1)) + margin
+}
+
+// place puts worm on the grid at freshly picked spawn positions and protects it
+// for a while, leaving it off the grid if there is no free space. It must be
+// called with server.mu held.
+func (server *Server) place(id string, worm *worm) error {
+	positions, error := server.spawnPositions()
+
+	if error != nil {
+		return error
+	}
+
+	worm.positions = positions
+	worm.invulnerableTill = time.Now().Add(spawnInvulnerability)
+
+	for _, position := range worm.positions {
+		server.grid[position.x][position.y].worm = id
+	}
+
+	return nil
+}
+
+// respawn puts worm back to the length and progress of a new worm somewhere
+// else on the grid. It must be called with server.mu held.
+func (server *Server) respawn(id string, worm *worm) error {
+	if error := server.place(id, worm); error != nil {
+		return error
+	}
+
+	worm.direction = "R"
+	worm.queuedDirections = nil
+	worm.foodConsumed = 0
+	worm.foodNeeded = server.foodNeeded(spawnLength)
+	worm.effects = map[string]time.Time{}
+	worm.heldBombs = 0
+	worm.foodTowardsBomb = 0
+	worm.kills = 0
+	worm.moveProgress = 0
+
+	return nil
+}
+
+// invulnerableMsg lists the worms still protected after spawning, with the
+// milliseconds of protection they have left. It must be called with
+// server.mu held.
+func (server *Server) invulnerableMsg() string {
+	msg := ""
+
+	for id, worm := range server.worms {
+		if remaining := time.Until(worm.invulnerableTill); remaining > 0 {
+			msg += "\n" + id + "," + strconv.FormatInt(remaining.Milliseconds(), 10)
+		}
+	}
+
+	if msg == "" {
+		return ""
+	}
+
+	return eventInvulnerable + msg
+}
+
+func (worm *worm) displayName(id string) string {
+	if worm.name == "" {
+		return "Worm " + id
+	}
+
+	return worm.name
+}
+
+// newWorm puts a new worm on the grid, returning errNoSpawn if there is no
+// room for it. It must be called with server.mu held.
+func (server *Server) newWorm(name string) (string, error) {
 	atomic.AddUint64(&server.wormIdCounter, 1)
 	id := strconv.FormatUint(server.wormIdCounter, 10)
 
-	x := rand.Intn(server.gridWidth-10) + 5
-	y := rand.Intn(server.gridHeight-10) + 5
-
-	wormPos := []pos{{x, y}, {x - 1, y}, {x - 2, y}}
-	server.worms[id] = &worm{
-		positions:    wormPos,
+	worm := &worm{
+		name:         name,
+		team:         server.assignTeam(),
 		direction:    "R",
 		foodConsumed: 0,
-		foodNeeded:   3 * server.levelMultiplier,
+		foodNeeded:   server.foodNeeded(spawnLength),
+		lastInput:    time.Now(),
+		effects:      map[string]time.Time{},
 	}
 
-	return id
+	if error := server.place(id, worm); error != nil {
+		return "", error
+	}
+
+	server.worms[id] = worm
+
+	return id, nil
 }
@@ -0,0 +1,484 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"wormo/gamemap"
+)
+
+func TestSpawnPositionsSmallGrids(t *testing.T) {
+	smallest, error := gamemap.Parse(strings.NewReader(strings.Repeat("..........\n", 10)))
+
+	if error != nil {
+		t.Fatal(error)
+	}
+
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		config Config
+	}{
+		{"smallest map", 0, 0, Config{Map: smallest}},
+		{"10x10 grid", 10, 10, Config{}},
+		{"11x10 grid", 11, 10, Config{}},
+		{"default grid", 30, 30, Config{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, test.width, test.height, test.config)
+
+			for i := 0; i < 100; i++ {
+				positions, error := server.spawnPositions()
+
+				if error != nil {
+					t.Fatal(error)
+				}
+
+				for _, position := range positions {
+					if position.x < 0 || position.x >= server.gridWidth || position.y < 0 || position.y >= server.gridHeight {
+						t.Fatalf("spawned off the grid at %v", positions)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewWormWithoutSpace(t *testing.T) {
+	server := newTestServer(t, 10, 10, Config{})
+
+	//walls everywhere but a gap too short for a worm and its clearance
+	for x := 0; x < server.gridWidth; x++ {
+		for y := 0; y < server.gridHeight; y++ {
+			server.grid[x][y].wall = y != 5 || x > 3
+		}
+	}
+
+	if _, error := server.spawnPositions(); error != errNoSpawn {
+		t.Fatalf("expected errNoSpawn, got %v", error)
+	}
+
+	if _, error := server.newWorm("late"); error != errNoSpawn {
+		t.Fatalf("expected errNoSpawn, got %v", error)
+	}
+
+	if len(server.worms) != 0 {
+		t.Fatal("a worm was added without space for it")
+	}
+
+	for x := 0; x < server.gridWidth; x++ {
+		for y := 0; y < server.gridHeight; y++ {
+			if server.grid[x][y].worm != "" {
+				t.Fatalf("cell %d:%d was taken by worm %s", x, y, server.grid[x][y].worm)
+			}
+		}
+	}
+
+	//a gap with room in front of the head is enough
+	server.grid[4][5].wall = false
+
+	id, error := server.newWorm("fits")
+
+	if error != nil {
+		t.Fatal(error)
+	}
+
+	if head := server.worms[id].positions[0]; head != (pos{2, 5}) {
+		t.Fatalf("spawned with its head at %v", head)
+	}
+}
+
+func TestConsumeFood(t *testing.T) {
+	//food needed at each length, from 1
+	curve := TableCurve([]int{1, 1, 3, 3, 3})
+
+	tests := []struct {
+		name         string
+		kind         string
+		shielded     bool
+		length       int
+		foodConsumed int
+		wantLength   int
+		wantConsumed int
+	}{
+		{"common", FoodCommon, false, 3, 0, 3, 1},
+		{"common grows", FoodCommon, false, 4, 2, 5, 0},
+		{"golden carries over", FoodGolden, false, 4, 1, 5, 1},
+		{"golden grows twice", FoodGolden, false, 1, 0, 3, 1},
+		{"poison", FoodPoison, false, 2, 1, 1, 0},
+		{"poison through a shield", FoodPoison, true, 3, 1, 2, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{LevelCurve: curve})
+
+			positions := []pos{}
+
+			for i := 0; i < test.length; i++ {
+				positions = append(positions, pos{10 - i, 10})
+			}
+
+			worm := addTestWorm(server, "1", 0, "R", positions...)
+			worm.foodConsumed = test.foodConsumed
+
+			if test.shielded {
+				worm.effects[itemShield] = time.Now().Add(time.Minute)
+			}
+
+			food := pos{11, 10}
+			server.placeFood(food, test.kind)
+
+			server.consumeFood("1", &server.grid[food.x][food.y], &food)
+
+			if len(worm.positions) != test.wantLength || worm.foodConsumed != test.wantConsumed {
+				t.Fatalf("worm is %d long with %d food, expected %d long with %d", len(worm.positions), worm.foodConsumed, test.wantLength, test.wantConsumed)
+			}
+
+			if worm.foodNeeded != curve(len(worm.positions)) {
+				t.Errorf("worm needs %d food, expected %d", worm.foodNeeded, curve(len(worm.positions)))
+			}
+
+			if test.shielded && !worm.hasEffect(itemShield) {
+				t.Error("poison used up the shield")
+			}
+		})
+	}
+}
+
+func TestShrinkDropsFood(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(server *Server)
+		poisoned bool
+		food     []pos
+		noFood   []pos
+	}{
+		{"trimmed cells become food", nil, false, []pos{{2, 10}, {1, 10}}, nil},
+		{"poison leaves nothing", nil, true, nil, []pos{{2, 10}, {1, 10}}},
+		{"skips cells another worm is on", func(server *Server) {
+			server.worms["2"] = &worm{positions: []pos{{1, 11}, {1, 10}}}
+		}, false, []pos{{2, 10}}, []pos{{1, 10}}},
+		{"skips cells holding items", func(server *Server) {
+			server.grid[1][10].item = "1"
+			server.items["1"] = &item{itemSpeed, pos{1, 10}}
+		}, false, []pos{{2, 10}}, []pos{{1, 10}}},
+		{"skips walls", func(server *Server) {
+			server.grid[1][10].wall = true
+		}, false, []pos{{2, 10}}, []pos{{1, 10}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{})
+			worm := addTestWorm(server, "1", 0, "R", testWormPositions(5)...)
+
+			if test.setup != nil {
+				test.setup(server)
+			}
+
+			server.shrink("1", worm, 2, test.poisoned)
+
+			if len(worm.positions) != 3 {
+				t.Fatalf("worm is %d long, expected 3", len(worm.positions))
+			}
+
+			for _, position := range test.food {
+				if cell := server.grid[position.x][position.y]; !cell.food || cell.worm != "" {
+					t.Errorf("%v should have become food", position)
+				}
+			}
+
+			for _, position := range test.noFood {
+				if server.grid[position.x][position.y].food {
+					t.Errorf("%v should not have become food", position)
+				}
+			}
+		})
+	}
+}
+
+func TestConsumeItem(t *testing.T) {
+	for kind := range itemKinds {
+		t.Run(kind, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{})
+			worm := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+
+			server.grid[6][5].item = "1"
+			server.items["1"] = &item{kind, pos{6, 5}}
+
+			collisions := map[string]*collisionInfo{}
+			server.move("1", "R", &collisions)
+
+			if !worm.hasEffect(kind) {
+				t.Fatal("the worm did not get the item's effect")
+			}
+
+			if len(server.items) != 0 || server.grid[6][5].item != "" {
+				t.Fatal("the item was left on the board")
+			}
+		})
+	}
+}
+
+func TestShield(t *testing.T) {
+	tests := []struct {
+		name       string
+		shielded   bool
+		length     int
+		amount     int
+		wantLength int
+		wantShield bool
+	}{
+		{"absorbs damage", true, 4, 2, 4, false},
+		{"kept when there is nothing to lose", true, 1, 1, 1, true},
+		{"unshielded", false, 4, 2, 2, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{})
+
+			positions := []pos{}
+
+			for i := 0; i < test.length; i++ {
+				positions = append(positions, pos{10 - i, 10})
+			}
+
+			worm := addTestWorm(server, "1", 0, "R", positions...)
+
+			if test.shielded {
+				worm.effects[itemShield] = time.Now().Add(time.Minute)
+			}
+
+			server.reduce("1", worm, test.amount)
+
+			if len(worm.positions) != test.wantLength {
+				t.Fatalf("worm is %d long, expected %d", len(worm.positions), test.wantLength)
+			}
+
+			if worm.hasEffect(itemShield) != test.wantShield {
+				t.Fatalf("shield left %v, expected %v", worm.hasEffect(itemShield), test.wantShield)
+			}
+		})
+	}
+}
+
+func TestShieldAbsorbsCollision(t *testing.T) {
+	tests := []struct {
+		name        string
+		shielded    bool
+		wantCollide bool
+	}{
+		{"shielded", true, false},
+		{"unshielded", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{})
+			worm := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+			addTestWorm(server, "2", 0, "U", pos{6, 4}, pos{6, 5}, pos{6, 6})
+
+			if test.shielded {
+				worm.effects[itemShield] = time.Now().Add(time.Minute)
+			}
+
+			collisions := map[string]*collisionInfo{}
+			server.move("1", "R", &collisions)
+
+			if _, collided := collisions["1"]; collided != test.wantCollide {
+				t.Fatalf("collided %v, expected %v", collided, test.wantCollide)
+			}
+
+			if worm.hasEffect(itemShield) {
+				t.Fatal("the shield was not used up")
+			}
+
+			if worm.positions[0] != (pos{5, 5}) {
+				t.Fatalf("head moved to %v, expected it to stay at 5:5", worm.positions[0])
+			}
+		})
+	}
+}
+
+func TestGhost(t *testing.T) {
+	tests := []struct {
+		name  string
+		ghost string
+	}{
+		{"ghost passes through", "1"},
+		{"worms pass through ghosts", "2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 20, Config{})
+			passing := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+			addTestWorm(server, "2", 0, "U", pos{6, 4}, pos{6, 5}, pos{6, 6})
+
+			server.worms[test.ghost].effects[itemGhost] = time.Now().Add(time.Minute)
+
+			collisions := map[string]*collisionInfo{}
+
+			for i := 0; i < 4; i++ {
+				server.move("1", "R", &collisions)
+			}
+
+			if len(collisions) != 0 {
+				t.Fatal("passing through a ghost counted as a collision")
+			}
+
+			if passing.positions[0] != (pos{9, 5}) {
+				t.Fatalf("head is at %v, expected 9:5", passing.positions[0])
+			}
+
+			for _, position := range []pos{{6, 4}, {6, 5}, {6, 6}} {
+				if owner := server.grid[position.x][position.y].worm; owner != "2" {
+					t.Fatalf("%v belongs to %q, expected the worm passed through", position, owner)
+				}
+			}
+		})
+	}
+}
+
+func TestMagnet(t *testing.T) {
+	server := newTestServer(t, 20, 20, Config{})
+	worm := addTestWorm(server, "1", 0, "R", pos{5, 5}, pos{4, 5}, pos{3, 5})
+	worm.effects[itemMagnet] = time.Now().Add(time.Minute)
+	worm.foodNeeded = 10
+
+	near := []pos{{6, 8}, {9, 5}, {4, 4}}
+	far := []pos{{6, 9}, {10, 5}, {1, 1}}
+
+	for _, position := range append(near, far...) {
+		server.placeFood(position, FoodCommon)
+	}
+
+	collisions := map[string]*collisionInfo{}
+	server.move("1", "R", &collisions)
+
+	if worm.foodConsumed != len(near) {
+		t.Fatalf("ate %d food, expected %d", worm.foodConsumed, len(near))
+	}
+
+	for _, position := range near {
+		if server.grid[position.x][position.y].food {
+			t.Errorf("food at %v was not pulled in", position)
+		}
+	}
+
+	for _, position := range far {
+		if !server.grid[position.x][position.y].food {
+			t.Errorf("food at %v is out of reach but was eaten", position)
+		}
+	}
+}
+
+func TestQueueDirection(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction string
+		length    int
+		inputs    []string
+		queued    []string
+	}{
+		{"turn", "R", 3, []string{"U"}, []string{"U"}},
+		{"repeat of current direction", "R", 3, []string{"R"}, []string{}},
+		{"repeat of queued direction", "R", 3, []string{"U", "U"}, []string{"U"}},
+		{"reversal", "R", 3, []string{"L"}, []string{}},
+		{"reversal of queued direction", "R", 3, []string{"U", "D"}, []string{"U"}},
+		{"reversal when one cell long", "R", 1, []string{"L"}, []string{"L"}},
+		{"u-turn in two moves", "R", 3, []string{"U", "L"}, []string{"U", "L"}},
+		{"full queue", "R", 3, []string{"U", "L", "D", "R", "U"}, []string{"U", "L", "D"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			worm := &worm{direction: test.direction, positions: make([]pos, test.length)}
+
+			for _, dir := range test.inputs {
+				worm.queueDirection(dir)
+			}
+
+			if strings.Join(worm.queuedDirections, "") != strings.Join(test.queued, "") {
+				t.Fatalf("queued %v, expected %v", worm.queuedDirections, test.queued)
+			}
+
+			for _, dir := range test.queued {
+				if next := worm.nextDirection(); next != dir {
+					t.Fatalf("moved %s, expected %s", next, dir)
+				}
+			}
+
+			last := test.direction
+
+			if len(test.queued) > 0 {
+				last = test.queued[len(test.queued)-1]
+			}
+
+			if next := worm.nextDirection(); next != last {
+				t.Fatalf("kept moving %s after the queue emptied, expected %s", next, last)
+			}
+		})
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		wrap     bool
+		position pos
+		dir      string
+		next     pos
+		onGrid   bool
+	}{
+		{"inside", false, pos{5, 5}, "R", pos{6, 5}, true},
+		{"off the left", false, pos{0, 3}, "L", pos{-1, 3}, false},
+		{"off the right", false, pos{19, 3}, "R", pos{20, 3}, false},
+		{"off the top", false, pos{3, 0}, "U", pos{3, -1}, false},
+		{"off the bottom", false, pos{3, 9}, "D", pos{3, 10}, false},
+		{"wrap left", true, pos{0, 3}, "L", pos{19, 3}, true},
+		{"wrap right", true, pos{19, 3}, "R", pos{0, 3}, true},
+		{"wrap top", true, pos{3, 0}, "U", pos{3, 9}, true},
+		{"wrap bottom", true, pos{3, 9}, "D", pos{3, 0}, true},
+		{"wrap inside", true, pos{5, 5}, "D", pos{5, 6}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, 20, 10, Config{WrapEdges: test.wrap})
+
+			next, onGrid := server.step(test.position, test.dir)
+
+			if next != test.next || onGrid != test.onGrid {
+				t.Fatalf("got %v %v, expected %v %v", next, onGrid, test.next, test.onGrid)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	server := newTestServer(t, 20, 10, Config{})
+
+	tests := []struct {
+		position pos
+		wrapped  pos
+	}{
+		{pos{0, 0}, pos{0, 0}},
+		{pos{19, 9}, pos{19, 9}},
+		{pos{20, 10}, pos{0, 0}},
+		{pos{-1, -1}, pos{19, 9}},
+		{pos{-21, -11}, pos{19, 9}},
+		{pos{45, 25}, pos{5, 5}},
+	}
+
+	for _, test := range tests {
+		if wrapped := server.wrap(test.position); wrapped != test.wrapped {
+			t.Errorf("wrap(%v) = %v, expected %v", test.position, wrapped, test.wrapped)
+		}
+	}
+}